@@ -1,11 +1,18 @@
 module github.com/tumb1er/go-reloader
 
-go 1.13
+go 1.18
 
 require (
 	github.com/judwhite/go-svc v1.1.2
-	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0 // indirect
+	github.com/klauspost/compress v1.11.13
 	github.com/sevlyar/go-daemon v0.1.5
 	github.com/urfave/cli v1.22.2
 	golang.org/x/sys v0.0.0-20191120155948-bd437916bb0e
 )
+
+require (
+	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0 // indirect
+	github.com/russross/blackfriday/v2 v2.0.1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+)
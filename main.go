@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/tumb1er/go-reloader/reloader"
+	"github.com/tumb1er/go-reloader/reloader/audit"
+	"github.com/tumb1er/go-reloader/reloader/control"
 	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/logging"
+	"github.com/tumb1er/go-reloader/reloader/release"
+	"github.com/tumb1er/go-reloader/reloader/schedule"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"github.com/tumb1er/go-reloader/reloader/state"
 	"github.com/urfave/cli"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,43 +28,91 @@ import (
 var Version = "0.2.0"
 
 func watch(c *cli.Context) error {
+	if c.Bool("dry-run") {
+		return run(c, c.Args(), printPlan)
+	}
+	return run(c, c.Args(), nil)
+}
+
+// run starts reloader supervising child executable with args. If action is set, it is performed instead.
+func run(c *cli.Context, args cli.Args, action func(r *reloader.Reloader) error) error {
 	var err error
 	var child string
-	r := reloader.NewReloader(c.App.Version)
+	opts := []reloader.Option{
+		reloader.WithVersion(c.App.Version),
+		reloader.WithInterval(c.Duration("interval")),
+		reloader.WithStaging(c.String("staging")),
+		reloader.WithTerminateTree(c.Bool("tree")),
+		reloader.WithRestart(c.Bool("restart")),
+		reloader.WithRestartOnFailure(c.Bool("restart-on-failure")),
+		reloader.WithExitCode(c.Bool("exit-code")),
+		reloader.WithChannel(c.String("channel")),
+		reloader.WithPin(c.String("pin")),
+		reloader.WithAllowDowngrade(c.Bool("allow-downgrade")),
+		reloader.WithVersionArg(c.String("version-arg")),
+		reloader.WithReadyMarker(c.Bool("ready-marker")),
+		reloader.WithSelfUpdateTimeout(c.Duration("self-update-timeout")),
+		reloader.WithHandover(c.Bool("handover")),
+		reloader.WithService(c.String("service")),
+		reloader.WithSmokeTest(c.Duration("smoke-timeout"), strings.Fields(c.String("smoke"))...),
+	}
 	if logfile := c.String("log"); logfile != "" {
-		if l, err := os.OpenFile(logfile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		if l, err := openOutput(logfile, c.App.Name, logging.Info); err != nil {
 			return err
 		} else {
 			defer executable.CloseFile(l)
-			r.SetLogger(log.New(l, "", log.LstdFlags))
+			if logging.IsSink(logfile) {
+				// syslog and journald add timestamps by themselves
+				opts = append(opts, reloader.WithLogger(log.New(l, "", 0)))
+			} else {
+				opts = append(opts, reloader.WithLogger(log.New(l, "", log.LstdFlags)))
+			}
 		}
 	}
+	tag := "child"
+	if len(args) > 0 {
+		tag = strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+	}
 	if stdout := c.String("stdout"); stdout != "" {
-		if w, err := os.OpenFile(stdout, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		if w, err := openOutput(stdout, tag, logging.Info); err != nil {
 			return err
 		} else {
 			defer executable.CloseFile(w)
-			r.SetStdout(w)
+			opts = append(opts, reloader.WithStdout(w))
 		}
 	}
 	if stderr := c.String("stderr"); stderr != "" {
-		if w, err := os.OpenFile(stderr, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		if w, err := openOutput(stderr, tag, logging.Err); err != nil {
 			return err
 		} else {
 			defer executable.CloseFile(w)
-			r.SetStderr(w)
+			opts = append(opts, reloader.WithStderr(w))
 		}
 	}
-	r.SetInterval(c.Duration("interval"))
-	if err := r.SetStaging(c.String("staging")); err != nil {
-		return err
-	}
-	args := c.Args()
 	if len(args) == 0 {
 		return errors.New("no child executable passed")
 	}
-	if child, err = filepath.Abs(args[0]); err != nil {
-		return err
+	if dir := c.String("state-dir"); dir != "" {
+		opts = append(opts, reloader.WithStateDir(dir))
+	}
+	if path := c.String("audit-log"); path != "" {
+		opts = append(opts, reloader.WithAuditLog(path))
+	}
+	if path := c.String("audit-key"); path != "" {
+		opts = append(opts, reloader.WithAuditKey(path))
+	}
+	if path := c.String("metrics-file"); path != "" {
+		opts = append(opts, reloader.WithMetricsFile(path))
+	}
+	if releases := c.String("releases"); releases != "" {
+		// child is started from current release directory
+		opts = append(opts, reloader.WithReleases(releases), reloader.WithKeepReleases(c.Int("keep-releases")))
+		child = filepath.Join(releases, "current", filepath.Base(args[0]))
+	}
+	if child == "" {
+		if child, err = filepath.Abs(args[0]); err != nil {
+			return err
+		}
 	}
 	if c.Bool("tmp") {
 		// Copy child executable to temporary file
@@ -66,14 +125,34 @@ func watch(c *cli.Context) error {
 			}
 		}()
 	}
-	if c.Bool("tree") {
-		r.SetTerminateTree(true)
+	opts = append(opts, reloader.WithChild(child, args[1:]...))
+
+	if src, err := updateSource(c); err != nil {
+		return err
+	} else if src != nil {
+		opts = append(opts, reloader.WithUpdateSource(src))
+	}
+
+	if hooks, err := hookOptions(c); err != nil {
+		return err
+	} else {
+		opts = append(opts, hooks...)
 	}
-	if c.Bool("restart") {
-		r.SetRestart(true)
+
+	if policy, err := policyOptions(c); err != nil {
+		return err
+	} else {
+		opts = append(opts, policy...)
 	}
+	opts = append(opts, reloader.WithControl(c.String("control")))
 
-	r.SetChild(child, args[1:]...)
+	r, err := reloader.New(opts...)
+	if err != nil {
+		return err
+	}
+	if action != nil {
+		return action(r)
+	}
 
 	service := c.String("service")
 	update := c.String("update")
@@ -81,19 +160,153 @@ func watch(c *cli.Context) error {
 		if update != "" {
 			return r.Update(update, true)
 		} else {
-			return r.Run()
+			return ignoreUpdated(r.Run())
 		}
 	} else {
 		if update != "" {
-			if err := r.Update(update, false); err != nil {
-				return err
-			}
-			return r.RestartDaemon(service)
+			return r.UpdateDaemon(update, service)
 		}
-		return r.Daemonize()
+		return ignoreUpdated(r.Daemonize())
 	}
 }
 
+// printPlan prints actions reloader would take on current update source contents as JSON.
+func printPlan(r *reloader.Reloader) error {
+	actions, err := r.Plan(context.Background())
+	if err != nil {
+		return err
+	}
+	if actions == nil {
+		actions = []reloader.PlannedAction{}
+	}
+	data, err := json.MarshalIndent(actions, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// ignoreUpdated treats reloader self-update as successful exit.
+func ignoreUpdated(err error) error {
+	if errors.Is(err, reloader.ErrUpdated) {
+		return nil
+	}
+	return err
+}
+
+// updateSource returns update source configured with --source flag, nil for staging directory.
+func updateSource(c *cli.Context) (source.UpdateSource, error) {
+	spec := c.String("source")
+	if spec == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	staging, err := filepath.Abs(c.String("staging"))
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		prefix := strings.TrimPrefix(u.Path, "/")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		return source.NewS3(c.String("s3-endpoint"), u.Host, prefix, c.String("s3-region"), staging), nil
+	case "oci", "oci+http":
+		scheme := "https"
+		if u.Scheme == "oci+http" {
+			scheme = "http"
+		}
+		// tag is selected by pinned version or release channel if it is not set explicitly
+		repository, tag := strings.TrimPrefix(u.Path, "/"), "latest"
+		if pin := c.String("pin"); pin != "" {
+			tag = pin
+		} else if c.IsSet("channel") {
+			tag = c.String("channel")
+		}
+		if i := strings.LastIndex(repository, ":"); i >= 0 {
+			repository, tag = repository[:i], repository[i+1:]
+		}
+		oci := source.NewOCI(scheme+"://"+u.Host, repository, tag, staging)
+		oci.Username = c.String("registry-user")
+		oci.Password = c.String("registry-password")
+		return oci, nil
+	}
+	return nil, fmt.Errorf("unsupported update source: %s", spec)
+}
+
+// hookOptions returns options registering command and webhook event handlers from command line.
+func hookOptions(c *cli.Context) ([]reloader.Option, error) {
+	var opts []reloader.Option
+	timeout := c.Duration("hook-timeout")
+	for _, spec := range c.StringSlice("hook") {
+		event, value, err := parseHook(spec)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Fields(value)
+		opts = append(opts, reloader.WithHook(event, reloader.CommandHook{Command: parts[0], Args: parts[1:], Timeout: timeout}))
+	}
+	for _, spec := range c.StringSlice("webhook") {
+		event, value, err := parseHook(spec)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, reloader.WithHook(event, reloader.WebHook{URL: value, Timeout: timeout}))
+	}
+	return opts, nil
+}
+
+// parseHook splits hook definition in "event=value" form.
+func parseHook(spec string) (reloader.HookEvent, string, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return "", "", fmt.Errorf("invalid hook definition: %s", spec)
+	}
+	event, err := reloader.ParseHookEvent(parts[0])
+	if err != nil {
+		return "", "", err
+	}
+	return event, strings.TrimSpace(parts[1]), nil
+}
+
+// policyOptions returns update policy, maintenance windows and rollout options from command line.
+func policyOptions(c *cli.Context) ([]reloader.Option, error) {
+	policy, err := reloader.ParseUpdatePolicy(c.String("policy"))
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(c.String("timezone"))
+	if err != nil {
+		return nil, err
+	}
+	opts := []reloader.Option{
+		reloader.WithUpdatePolicy(policy),
+		reloader.WithRollout(c.Int("rollout")),
+		reloader.WithRolloutDelay(c.Duration("rollout-delay")),
+	}
+	for _, spec := range c.StringSlice("window") {
+		w, err := schedule.NewWindow(spec, c.Duration("window-duration"), loc)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, reloader.WithMaintenanceWindow(w))
+	}
+	return opts, nil
+}
+
+// openOutput opens a log file for appending or connects to syslog/journald sink.
+func openOutput(spec, tag string, priority logging.Priority) (io.WriteCloser, error) {
+	if logging.IsSink(spec) {
+		return logging.Open(spec, tag, priority)
+	}
+	return os.OpenFile(spec, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
 func copyToTemp(child string) (string, error) {
 	basename := filepath.Base(child)
 	dir, err := ioutil.TempDir("", strings.Split(basename, ".")[0])
@@ -118,6 +331,225 @@ func copyToTemp(child string) (string, error) {
 	return dst, nil
 }
 
+// controlFlag sets control socket path for control commands.
+var controlFlag = &cli.StringFlag{
+	Name:  "control",
+	Usage: "reloader control socket path",
+}
+
+// controlPath returns control socket path from command or global flag.
+func controlPath(c *cli.Context) string {
+	if path := c.String("control"); path != "" {
+		return path
+	}
+	return c.GlobalString("control")
+}
+
+// controlCall sends a command to running reloader and prints it's result.
+func controlCall(c *cli.Context, command string) error {
+	path := controlPath(c)
+	if path == "" {
+		return errors.New("control socket path is not set")
+	}
+	var result interface{}
+	if err := control.Call(context.Background(), path, &result, command, c.Args()...); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// forceFlag allows commands to switch child directly when running reloader can't be ruled out.
+var forceFlag = &cli.BoolFlag{
+	Name:  "force",
+	Usage: "switch child directly even if reloader may be running",
+}
+
+// callOrRun sends command with arg to reloader running with control socket. If nothing listens on control socket,
+// action is performed by reloader configured with global options for child executable passed as command args,
+// but only if reloader pid file shows that no reloader is running or with --force.
+func callOrRun(c *cli.Context, command, arg string, action func(r *reloader.Reloader) error) error {
+	if path := controlPath(c); path != "" {
+		err := control.Call(context.Background(), path, nil, command, arg)
+		if !errors.Is(err, control.ErrUnavailable) {
+			return err
+		}
+	}
+	return run(c.Parent(), c.Args(), func(r *reloader.Reloader) error {
+		if err := r.CheckStopped(); err != nil && !c.Bool("force") {
+			return fmt.Errorf("%w, use control socket or --force to %s anyway", err, command)
+		}
+		return action(r)
+	})
+}
+
+// applyUpdate applies update with requested version or latest update regardless of update policy.
+func applyUpdate(c *cli.Context) error {
+	v := c.String("version")
+	return callOrRun(c, "apply", v, func(r *reloader.Reloader) error {
+		return r.ApplyStopped(context.Background(), v)
+	})
+}
+
+// rollbackUpdate switches child back to previous binary or release.
+func rollbackUpdate(c *cli.Context) error {
+	to := c.String("to")
+	return callOrRun(c, "rollback", to, func(r *reloader.Reloader) error {
+		return r.RollbackStopped(context.Background(), to)
+	})
+}
+
+// releasesFlag sets releases root directory for release management commands.
+var releasesFlag = &cli.StringFlag{
+	Name:  "releases",
+	Usage: "versioned releases root directory",
+}
+
+// releasesRoot returns releases root directory from command or global flag.
+func releasesRoot(c *cli.Context) (*release.Releases, error) {
+	root := c.String("releases")
+	if root == "" {
+		root = c.GlobalString("releases")
+	}
+	if root == "" {
+		return nil, errors.New("releases root directory is not set")
+	}
+	return release.New(root), nil
+}
+
+// listReleases prints installed releases, current one is marked with asterisk.
+func listReleases(c *cli.Context) error {
+	releases, err := releasesRoot(c)
+	if err != nil {
+		return err
+	}
+	list, err := releases.List()
+	if err != nil {
+		return err
+	}
+	for _, info := range list {
+		mark := " "
+		if info.Current {
+			mark = "*"
+		}
+		fmt.Printf("%s %s %s\n", mark, info.ID, info.Installed.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// activateRelease makes an installed release current.
+func activateRelease(c *cli.Context) error {
+	releases, err := releasesRoot(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() != 1 {
+		return errors.New("release id expected")
+	}
+	return releases.Activate(c.Args().First())
+}
+
+// stateFlag sets state directory for history command.
+var stateFlag = &cli.StringFlag{
+	Name:  "state-dir",
+	Usage: "reloader state directory",
+}
+
+// short returns checksum prefix for printing.
+func short(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
+
+// showHistory prints update history, bad builds and counters from reloader state.
+func showHistory(c *cli.Context) error {
+	dir := c.String("state-dir")
+	if dir == "" {
+		dir = c.GlobalString("state-dir")
+	}
+	if dir == "" {
+		return errors.New("state directory is not set")
+	}
+	st, err := state.Read(dir)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		data, err := json.MarshalIndent(st, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if !st.LastCheck.IsZero() {
+		fmt.Printf("last check: %s\n", st.LastCheck.Format(time.RFC3339))
+	}
+	fmt.Printf("restarts: %d\n", st.Restarts)
+	fmt.Printf("crashes: %d\n", st.Crashes)
+	if st.LastExit != nil {
+		fmt.Printf("last exit: %s\n", st.LastExit)
+	}
+	for _, e := range st.History {
+		line := fmt.Sprintf("%s %s %s %s -> %s %s %s", e.Time.Format(time.RFC3339), e.Action, e.Name,
+			short(e.From), short(e.To), e.Version, e.Release)
+		fmt.Println(strings.TrimSpace(line))
+	}
+	for _, f := range st.Failures {
+		fmt.Printf("failed %s %s %s: %s\n", f.Name, short(f.Checksum), f.Version, f.Reason)
+	}
+	return nil
+}
+
+// auditFlag sets audit log path for audit commands.
+var auditFlag = &cli.StringFlag{
+	Name:  "audit-log",
+	Usage: "audit log file path",
+}
+
+// auditKeyFlag sets audit log HMAC key file for audit commands.
+var auditKeyFlag = &cli.StringFlag{
+	Name:  "audit-key",
+	Usage: "audit log HMAC key file",
+}
+
+// verifyAudit checks audit log hash chain.
+func verifyAudit(c *cli.Context) error {
+	path := c.String("audit-log")
+	if path == "" {
+		path = c.GlobalString("audit-log")
+	}
+	if path == "" {
+		return errors.New("audit log path is not set")
+	}
+	var key []byte
+	keyPath := c.String("audit-key")
+	if keyPath == "" {
+		keyPath = c.GlobalString("audit-key")
+	}
+	if keyPath != "" {
+		var err error
+		if key, err = audit.ReadKey(keyPath); err != nil {
+			return err
+		}
+	}
+	n, err := audit.Verify(path, key)
+	if err != nil {
+		return fmt.Errorf("%s: %d entries verified, %s", path, n, err.Error())
+	}
+	fmt.Printf("%s: %d entries verified\n", path, n)
+	return nil
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "reloader"
@@ -130,6 +562,10 @@ func main() {
 			Name:  "update",
 			Usage: "perform update of executable and exit",
 		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print actions reloader would take on current staging contents as JSON and exit, runs staged binaries",
+		},
 		&cli.DurationFlag{
 			Name:  "interval",
 			Value: time.Minute,
@@ -140,6 +576,126 @@ func main() {
 			Value: "staging",
 			Usage: "staging directory path",
 		},
+		&cli.StringFlag{
+			Name:  "releases",
+			Usage: "versioned releases root directory, child is started from <releases>/current/<cmd>",
+		},
+		&cli.IntFlag{
+			Name:  "keep-releases",
+			Value: 5,
+			Usage: "number of releases kept on disk, 0 keeps all releases",
+		},
+		&cli.StringFlag{
+			Name:  "channel",
+			Value: "stable",
+			Usage: "release channel selecting artifacts from manifest.json, i.e. stable, beta or canary",
+		},
+		&cli.StringFlag{
+			Name:  "pin",
+			Usage: "pin child to an exact version, other versions are refused",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-downgrade",
+			Usage: "apply updates with versions older than running binary",
+		},
+		&cli.StringFlag{
+			Name:  "version-arg",
+			Usage: "argument printing binary version, i.e. --version, used if version is not embedded or in a sidecar file",
+		},
+		&cli.BoolFlag{
+			Name:  "ready-marker",
+			Usage: "require <name>.ready marker files for staged updates instead of waiting for staged files to be unchanged",
+		},
+		&cli.StringFlag{
+			Name:  "smoke",
+			Usage: "arguments for staged child binary smoke test run before switching, i.e. --version",
+		},
+		&cli.DurationFlag{
+			Name:  "smoke-timeout",
+			Usage: "staged child binary smoke test time limit",
+			Value: 10 * time.Second,
+		},
+		&cli.DurationFlag{
+			Name:  "self-update-timeout",
+			Usage: "time limit for updated reloader to report it is ready, previous binary is restored otherwise",
+			Value: 30 * time.Second,
+		},
+		&cli.BoolFlag{
+			Name:  "handover",
+			Usage: "keep child running across reloader self updates, updated reloader adopts it",
+		},
+		&cli.StringFlag{
+			Name:  "state-dir",
+			Usage: "directory keeping update history, bad builds and restart counter across reloader restarts",
+		},
+		&cli.StringFlag{
+			Name:  "audit-log",
+			Usage: "append-only hash-chained log of binary replacements and restarts",
+		},
+		&cli.StringFlag{
+			Name:  "audit-key",
+			Usage: "file with HMAC key of audit log entries, audit log can't be rewritten without it",
+		},
+		&cli.StringFlag{
+			Name:  "metrics-file",
+			Usage: "file child process metrics are written to in Prometheus text format",
+		},
+		&cli.StringFlag{
+			Name:  "source",
+			Usage: "remote update source downloaded to staging directory, i.e. s3://bucket/prefix or oci://registry/repo:tag",
+		},
+		&cli.StringFlag{
+			Name:  "s3-endpoint",
+			Value: "https://s3.amazonaws.com",
+			Usage: "S3-compatible storage endpoint",
+		},
+		&cli.StringFlag{
+			Name:  "s3-region",
+			Value: "us-east-1",
+			Usage: "S3 region used for request signing",
+		},
+		&cli.StringFlag{
+			Name:   "registry-user",
+			EnvVar: "REGISTRY_USERNAME",
+			Usage:  "OCI registry user name",
+		},
+		&cli.StringFlag{
+			Name:   "registry-password",
+			EnvVar: "REGISTRY_PASSWORD",
+			Usage:  "OCI registry password or access token",
+		},
+		&cli.StringFlag{
+			Name:  "policy",
+			Value: string(reloader.PolicyImmediate),
+			Usage: "update policy: immediate, window (apply within maintenance windows) or manual (apply on command)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "window",
+			Usage: "maintenance window start as cron expression, i.e. \"0 2 * * mon-fri\"",
+		},
+		&cli.DurationFlag{
+			Name:  "window-duration",
+			Value: time.Hour,
+			Usage: "maintenance window duration",
+		},
+		&cli.StringFlag{
+			Name:  "timezone",
+			Value: "Local",
+			Usage: "maintenance windows time zone, i.e. Europe/Berlin",
+		},
+		&cli.IntFlag{
+			Name:  "rollout",
+			Value: 100,
+			Usage: "percentage of hosts taking an update unless manifest.json sets it",
+		},
+		&cli.DurationFlag{
+			Name:  "rollout-delay",
+			Usage: "maximum random delay before applying an update",
+		},
+		&cli.StringFlag{
+			Name:  "control",
+			Usage: "control socket path for status, apply, rollback and restart commands",
+		},
 		&cli.StringFlag{
 			Name:  "service",
 			Usage: "daemon/service name",
@@ -147,17 +703,17 @@ func main() {
 		&cli.StringFlag{
 			Name:  "log",
 			Value: "",
-			Usage: "reloader log file",
+			Usage: "reloader log file or sink (syslog, syslog:/dev/log, syslog://host:514, journald)",
 		},
 		&cli.StringFlag{
 			Name:  "stdout",
 			Value: "",
-			Usage: "child process stdout file",
+			Usage: "child process stdout file or sink",
 		},
 		&cli.StringFlag{
 			Name:  "stderr",
 			Value: "",
-			Usage: "child process stderr file",
+			Usage: "child process stderr file or sink",
 		},
 		&cli.BoolFlag{
 			Name:  "tmp",
@@ -171,9 +727,131 @@ func main() {
 			Name:  "restart",
 			Usage: "restart child process after exit",
 		},
+		&cli.BoolFlag{
+			Name:  "restart-on-failure",
+			Usage: "restart child process after non-zero exit code or termination by signal",
+		},
+		&cli.BoolFlag{
+			Name:  "exit-code",
+			Usage: "exit with child exit code when child exits and is not restarted",
+		},
+		&cli.StringSliceFlag{
+			Name:  "hook",
+			Usage: "run command on lifecycle event, i.e. after-switch=/usr/bin/notify.sh",
+		},
+		&cli.StringSliceFlag{
+			Name:  "webhook",
+			Usage: "post JSON to URL on lifecycle event, i.e. child-exited=http://localhost/hook",
+		},
+		&cli.DurationFlag{
+			Name:  "hook-timeout",
+			Value: reloader.DefaultHookTimeout,
+			Usage: "event hook execution timeout",
+		},
 	}
 	app.Action = watch
+	app.Commands = []cli.Command{
+		{
+			Name:      "check",
+			Usage:     "print actions reloader would take on current staging contents as JSON, global options apply",
+			ArgsUsage: "<cmd> [<arg>...]",
+			Action: func(c *cli.Context) error {
+				return run(c.Parent(), c.Args(), printPlan)
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "show running reloader status and pending updates",
+			Flags: []cli.Flag{controlFlag},
+			Action: func(c *cli.Context) error {
+				return controlCall(c, "status")
+			},
+		},
+		{
+			Name:      "apply",
+			Usage:     "apply pending update regardless of update policy, switch child directly if reloader is not running",
+			ArgsUsage: "[<cmd>]",
+			Flags: []cli.Flag{
+				controlFlag,
+				forceFlag,
+				&cli.StringFlag{
+					Name:  "version",
+					Usage: "child version to apply, regardless of pin and version ordering",
+				},
+			},
+			Action: applyUpdate,
+		},
+		{
+			Name:      "rollback",
+			Usage:     "switch child back to previous binary or release, directly if reloader is not running",
+			ArgsUsage: "[<cmd>]",
+			Flags: []cli.Flag{
+				controlFlag,
+				forceFlag,
+				&cli.StringFlag{
+					Name:  "to",
+					Usage: "installed release id or version to roll back to",
+				},
+			},
+			Action: rollbackUpdate,
+		},
+		{
+			Name:  "restart",
+			Usage: "restart child process with current binary",
+			Flags: []cli.Flag{controlFlag},
+			Action: func(c *cli.Context) error {
+				return controlCall(c, "restart")
+			},
+		},
+		{
+			Name:  "audit",
+			Usage: "inspect audit log",
+			Subcommands: []cli.Command{
+				{
+					Name:   "verify",
+					Usage:  "check that audit log entries are not modified, removed or reordered",
+					Flags:  []cli.Flag{auditFlag, auditKeyFlag},
+					Action: verifyAudit,
+				},
+			},
+		},
+		{
+			Name:  "history",
+			Usage: "show update history and bad builds from reloader state",
+			Flags: []cli.Flag{
+				stateFlag,
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "print state as JSON",
+				},
+			},
+			Action: showHistory,
+		},
+		{
+			Name:  "releases",
+			Usage: "manage installed releases",
+			Subcommands: []cli.Command{
+				{
+					Name:   "list",
+					Usage:  "list installed releases",
+					Flags:  []cli.Flag{releasesFlag},
+					Action: listReleases,
+				},
+				{
+					Name:      "activate",
+					Usage:     "make release current, running reloader restarts child with it",
+					ArgsUsage: "<id>",
+					Flags:     []cli.Flag{releasesFlag},
+					Action:    activateRelease,
+				},
+			},
+		},
+	}
 	err := app.Run(os.Args)
+	var e *reloader.ChildExitError
+	if errors.As(err, &e) {
+		os.Exit(e.Status.ShellCode())
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
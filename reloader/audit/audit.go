@@ -0,0 +1,316 @@
+// Package audit implements append-only hash-chained log of binary replacements and restarts.
+// Number of entries and last entry hash are kept in a separate head file, so removed trailing entries are detected.
+// With a key, entry hashes and head are HMAC-SHA256, so log can't be rewritten without the key.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"hash"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audited actions.
+const (
+	Switch     = "switch"
+	Rollback   = "rollback"
+	SelfUpdate = "self-update"
+	Restart    = "restart"
+)
+
+// maxEntrySize limits audit log entry size.
+const maxEntrySize = 64 * 1024
+
+// HeadSuffix is appended to audit log path to get head file path.
+const HeadSuffix = ".head"
+
+// Entry is an audit log record. Hash is computed over entry JSON without hash and includes previous entry hash.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// executable name
+	Name string `json:"name"`
+	// replaced and new binary checksums and versions, equal for restarts
+	FromChecksum string `json:"from_checksum,omitempty"`
+	ToChecksum   string `json:"to_checksum,omitempty"`
+	FromVersion  string `json:"from_version,omitempty"`
+	ToVersion    string `json:"to_version,omitempty"`
+	// update location or release
+	Source string `json:"source,omitempty"`
+	// what initiated the action: ticker, control, signal, exit or command
+	Actor string `json:"actor"`
+	// previous entry hash, empty for first entry
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// Head describes audit log end.
+type Head struct {
+	// number of entries in log
+	Count int `json:"count"`
+	// last entry hash
+	Hash string `json:"hash"`
+	// head HMAC, empty if log has no key
+	MAC string `json:"mac,omitempty"`
+}
+
+// newHash returns entry hash function, HMAC-SHA256 if key is set.
+func newHash(key []byte) hash.Hash {
+	if len(key) > 0 {
+		return hmac.New(sha256.New, key)
+	}
+	return sha256.New()
+}
+
+// sum computes entry hash.
+func (e Entry) sum(key []byte) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	h := newHash(key)
+	_, _ = h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// mac computes head HMAC, empty if key is not set.
+func (h Head) mac(key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
+	m := hmac.New(sha256.New, key)
+	_, _ = fmt.Fprintf(m, "%d %s", h.Count, h.Hash)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// readHead reads head file of log at path, zero head is returned if it doesn't exist.
+func readHead(path string) (Head, error) {
+	var h Head
+	data, err := ioutil.ReadFile(path + HeadSuffix)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return h, fmt.Errorf("audit log head: %s", err.Error())
+	}
+	return h, nil
+}
+
+// writeHead replaces head file of log at path.
+func writeHead(path string, h Head) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	tmp := path + HeadSuffix + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path+HeadSuffix)
+}
+
+// checkHead checks that head matches log with count entries and last entry hash last.
+// Missing head matches only empty log.
+func checkHead(h Head, count int, last string, key []byte) error {
+	if h == (Head{}) {
+		if count > 0 {
+			return errors.New("head is missing")
+		}
+		return nil
+	}
+	if h.MAC != h.mac(key) {
+		return errors.New("head is modified or audit key is wrong")
+	}
+	if h.Count != count || h.Hash != last {
+		return fmt.Errorf("head expects %d entries, entries are removed or added without head update", h.Count)
+	}
+	return nil
+}
+
+// Log appends entries to a JSON lines file.
+type Log struct {
+	path string
+	key  []byte
+	mu   sync.Mutex
+}
+
+// New returns audit log at path.
+func New(path string) *Log {
+	return &Log{path: path}
+}
+
+// ReadKey reads audit key from file, surrounding whitespace is ignored.
+func ReadKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("audit key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// SetKey makes log compute HMAC-SHA256 of entries and head with key.
+func (l *Log) SetKey(key []byte) {
+	l.key = key
+}
+
+// Path returns audit log file path.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// open opens log file for appending and locks it. It returns last entry hash and log head, checking that log
+// hash chain is valid and matches it's head, so modified or removed entries are not hidden by following ones.
+// Caller must unlock and close the file.
+func (l *Log) open() (*os.File, string, Head, error) {
+	var h Head
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, "", h, err
+	}
+	if err := lockFile(f); err != nil {
+		executable.CloseFile(f)
+		return nil, "", h, err
+	}
+	n, prev, err := verify(f, l.key)
+	if err == nil {
+		h, err = readHead(l.path)
+	}
+	if err == nil {
+		err = checkHead(h, n, prev, l.key)
+	}
+	if err != nil {
+		_ = unlockFile(f)
+		executable.CloseFile(f)
+		return nil, "", h, fmt.Errorf("audit log %s is tampered with: %s, see audit verify", l.path, err.Error())
+	}
+	return f, prev, h, nil
+}
+
+// Check reports an error if entries can't be appended to log, i.e. it is not writable or doesn't match it's head.
+func (l *Log) Check() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, _, _, err := l.open()
+	if err != nil {
+		return err
+	}
+	_ = unlockFile(f)
+	executable.CloseFile(f)
+	return nil
+}
+
+// Append chains entry to last log entry, writes it to the end of log and updates head.
+// Log file is locked while it is appended, so log may be appended by several processes. Entries are not appended
+// to a log not matching it's head, see Check.
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, prev, h, err := l.open()
+	if err != nil {
+		return err
+	}
+	defer executable.CloseFile(f)
+	defer func() { _ = unlockFile(f) }()
+	e.Prev = prev
+	e.Time = e.Time.UTC()
+	if e.Hash, err = e.sum(l.key); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	h = Head{Count: h.Count + 1, Hash: e.Hash}
+	h.MAC = h.mac(l.key)
+	return writeHead(l.path, h)
+}
+
+// verify checks hash chain of log file f read from start and returns number of verified entries and last entry
+// hash.
+func verify(f *os.File, key []byte) (int, string, error) {
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, maxEntrySize), maxEntrySize)
+	prev := ""
+	n := 0
+	for s.Scan() {
+		line := s.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		n++
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return n - 1, prev, fmt.Errorf("entry %d: %s", n, err.Error())
+		}
+		if e.Prev != prev {
+			return n - 1, prev, fmt.Errorf("entry %d: previous hash mismatch, entries are removed or reordered", n)
+		}
+		sum, err := e.sum(key)
+		if err != nil {
+			return n - 1, prev, err
+		}
+		if sum != e.Hash {
+			return n - 1, prev, fmt.Errorf("entry %d: hash mismatch, entry is modified or audit key is wrong", n)
+		}
+		prev = e.Hash
+	}
+	return n, prev, s.Err()
+}
+
+// Verify checks hash chain of audit log at path and it's head and returns number of verified entries.
+// Key must be the same as log is appended with, nil if log has no key.
+func Verify(path string, key []byte) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer executable.CloseFile(f)
+	if err := lockFile(f); err != nil {
+		return 0, err
+	}
+	defer func() { _ = unlockFile(f) }()
+	n, prev, err := verify(f, key)
+	if err != nil {
+		return n, err
+	}
+	h, err := readHead(path)
+	if err != nil {
+		return n, err
+	}
+	return n, checkHead(h, n, prev, key)
+}
@@ -0,0 +1,225 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newLog returns audit log in a temporary directory removed by cleanup.
+func newLog(t *testing.T, key []byte) (*Log, func()) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New(filepath.Join(dir, "audit.log"))
+	l.SetKey(key)
+	return l, func() { _ = os.RemoveAll(dir) }
+}
+
+// appendEntries appends n switch entries to log.
+func appendEntries(t *testing.T, l *Log, n int) {
+	for i := 0; i < n; i++ {
+		if err := l.Append(Entry{
+			Time:         time.Now(),
+			Action:       Switch,
+			Name:         "app",
+			FromChecksum: fmt.Sprintf("%064d", i),
+			ToChecksum:   fmt.Sprintf("%064d", i+1),
+			Actor:        "ticker",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := []byte("secret")
+	testCases := []struct {
+		name string
+		key  []byte
+		// verification key
+		verify []byte
+		err    bool
+	}{
+		{"chain", nil, nil, false},
+		{"keyed chain", key, key, false},
+		{"wrong key", key, []byte("other"), true},
+		{"missing key", key, nil, true},
+		{"unexpected key", nil, key, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, cleanup := newLog(t, tc.key)
+			defer cleanup()
+			appendEntries(t, l, 3)
+			n, err := Verify(l.Path(), tc.verify)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 3 {
+				t.Fatalf("%d entries verified, expected 3", n)
+			}
+		})
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tamper func(t *testing.T, path string, lines [][]byte)
+	}{
+		{"truncated", func(t *testing.T, path string, lines [][]byte) {
+			writeLines(t, path, lines[:2])
+		}},
+		{"first entry removed", func(t *testing.T, path string, lines [][]byte) {
+			writeLines(t, path, lines[1:])
+		}},
+		{"reordered", func(t *testing.T, path string, lines [][]byte) {
+			writeLines(t, path, [][]byte{lines[1], lines[0], lines[2]})
+		}},
+		{"modified", func(t *testing.T, path string, lines [][]byte) {
+			lines[1] = bytes.Replace(lines[1], []byte(`"ticker"`), []byte(`"signal"`), 1)
+			writeLines(t, path, lines)
+		}},
+		{"rewritten without key", func(t *testing.T, path string, lines [][]byte) {
+			// valid chain and head without key don't match keyed log
+			l := New(path)
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(path + HeadSuffix); err != nil {
+				t.Fatal(err)
+			}
+			appendEntries(t, l, 3)
+		}},
+		{"head removed", func(t *testing.T, path string, lines [][]byte) {
+			if err := os.Remove(path + HeadSuffix); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"head modified", func(t *testing.T, path string, lines [][]byte) {
+			h, err := readHead(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.Count++
+			if err := writeHead(path, h); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	key := []byte("secret")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, cleanup := newLog(t, key)
+			defer cleanup()
+			appendEntries(t, l, 3)
+			data, err := ioutil.ReadFile(l.Path())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.tamper(t, l.Path(), bytes.Split(bytes.TrimSpace(data), []byte("\n")))
+			if _, err := Verify(l.Path(), key); err == nil {
+				t.Fatal("tampered log is verified")
+			}
+			// entries are not appended to tampered log
+			if err := l.Check(); err == nil {
+				t.Fatal("tampered log is appendable")
+			}
+			if err := l.Append(Entry{Action: Restart, Name: "app"}); err == nil {
+				t.Fatal("entry is appended to tampered log")
+			}
+		})
+	}
+}
+
+// writeLines replaces file at path with lines.
+func writeLines(t *testing.T, path string, lines [][]byte) {
+	data := append(bytes.Join(lines, []byte("\n")), '\n')
+	if err := ioutil.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	l, cleanup := newLog(t, nil)
+	defer cleanup()
+	if err := l.Check(); err != nil {
+		t.Fatalf("empty log: %v", err)
+	}
+	appendEntries(t, l, 1)
+	if err := l.Check(); err != nil {
+		t.Fatal(err)
+	}
+	missing := New(filepath.Join(l.Path(), "missing", "audit.log"))
+	if err := missing.Check(); err == nil {
+		t.Fatal("expected error for log in missing directory")
+	}
+}
+
+func TestConcurrentAppend(t *testing.T) {
+	l, cleanup := newLog(t, []byte("secret"))
+	defer cleanup()
+	const writers, entries = 4, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*entries)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		// separate logs lock the file as separate processes do
+		w := New(l.Path())
+		w.SetKey([]byte("secret"))
+		go func() {
+			defer wg.Done()
+			for j := 0; j < entries; j++ {
+				errs <- w.Append(Entry{Time: time.Now(), Action: Restart, Name: "app", Actor: "signal"})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := Verify(l.Path(), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != writers*entries {
+		t.Fatalf("%d entries verified, expected %d", n, writers*entries)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(path, []byte(" secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := ReadKey(path); err != nil || string(key) != "secret" {
+		t.Fatalf("key %q, %v", key, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadKey(path); err == nil {
+		t.Fatal("expected error for empty key")
+	}
+}
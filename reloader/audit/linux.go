@@ -0,0 +1,18 @@
+// +build linux
+
+package audit
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes exclusive lock on file, waiting for other processes to release it.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// unlockFile releases file lock.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
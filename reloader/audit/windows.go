@@ -0,0 +1,18 @@
+// +build windows
+
+package audit
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// lockFile takes exclusive lock on file, waiting for other processes to release it.
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+}
+
+// unlockFile releases file lock.
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
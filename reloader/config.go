@@ -1,6 +1,10 @@
 package reloader
 
 import (
+	"github.com/tumb1er/go-reloader/reloader/audit"
+	"github.com/tumb1er/go-reloader/reloader/release"
+	"github.com/tumb1er/go-reloader/reloader/schedule"
+	"github.com/tumb1er/go-reloader/reloader/source"
 	"io"
 	"log"
 	"path/filepath"
@@ -18,10 +22,65 @@ type Config struct {
 	tree bool
 	// child auto restart flag
 	restart bool
+	// restart child only if it exits with non-zero code or is terminated by signal
+	restartOnFailure bool
+	// exit with child exit code when child exits and is not restarted
+	exitCode bool
 	// child executable
 	child string
 	// child process args
 	args []string
+	// disable interrupt signal handling
+	noSignals bool
+
+	// versioned releases layout for bundle updates, nil if disabled
+	releases *release.Releases
+	// number of releases kept on disk, 0 keeps all
+	keepReleases int
+	// update source, staging directory if not set
+	source source.UpdateSource
+	// lifecycle event hooks
+	hooks map[HookEvent][]Hook
+	// when detected updates are applied
+	policy UpdatePolicy
+	// maintenance windows for window update policy
+	windows []schedule.Window
+	// percentage of hosts taking an update unless source manifest sets it
+	rollout int
+	// maximum random delay before applying an update
+	rolloutDelay time.Duration
+	// host name for rollout decisions, os.Hostname if empty
+	host string
+	// release channel for manifest artifacts selection
+	channel string
+	// exact child version, other versions are refused
+	pin string
+	// apply updates older than current binary
+	allowDowngrade bool
+	// argument printing binary version, i.e. --version, versions are not probed if empty
+	versionArg string
+	// require <name>.ready markers for staged files instead of waiting for them to be stable
+	readyMarker bool
+	// args for staged child binary smoke test, i.e. --version, smoke test is disabled if empty
+	smoke []string
+	// smoke test time limit
+	smokeTimeout time.Duration
+	// time limit for updated reloader to report it is ready
+	selfUpdateTimeout time.Duration
+	// running child is adopted by updated reloader instead of restarting it
+	handover bool
+	// service name, reloader runs as a daemon restarted by service manager on self update if set
+	service string
+	// directory keeping reloader state across restarts, state is not kept if empty
+	stateDir string
+	// audit log file path, audit log is disabled if empty
+	auditFile string
+	// audit log HMAC key, entries are only hashed if empty
+	auditKey []byte
+	// child metrics file path in Prometheus text format, metrics are not written if empty
+	metricsFile string
+	// control socket path, control interface is disabled if empty
+	control string
 
 	stderr io.Writer
 	stdout io.Writer
@@ -67,8 +126,170 @@ func (c *Config) SetRestart(restart bool) {
 	c.restart = restart
 }
 
+// SetRestartOnFailure configures child restarts after failures only: non-zero exit code or termination by signal.
+func (c *Config) SetRestartOnFailure(restart bool) {
+	c.restartOnFailure = restart
+}
+
+// SetExitCode configures reloader to exit with child exit code when child exits and is not restarted.
+// Child terminated by signal is reported as 128 + signal number.
+func (c *Config) SetExitCode(exitCode bool) {
+	c.exitCode = exitCode
+}
+
 // SetChild configures child cmd and arguments.
 func (c *Config) SetChild(child string, args ...string) {
 	c.child = child
 	c.args = args
 }
+
+// AddHook registers a handler for a lifecycle event.
+func (c *Config) AddHook(event HookEvent, hook Hook) {
+	if c.hooks == nil {
+		c.hooks = make(map[HookEvent][]Hook)
+	}
+	c.hooks[event] = append(c.hooks[event], hook)
+}
+
+// SetHandleSignals configures interrupt signal handling in Run, enabled by default.
+func (c *Config) SetHandleSignals(handle bool) {
+	c.noSignals = !handle
+}
+
+// SetUpdateSource configures update source, staging directory is used by default.
+func (c *Config) SetUpdateSource(s source.UpdateSource) {
+	c.source = s
+}
+
+// SetReleases enables bundle updates installed to versioned release directories under root.
+// Child executable is started from root/current symlink.
+func (c *Config) SetReleases(root string) error {
+	var err error
+	if root, err = filepath.Abs(root); err != nil {
+		return err
+	}
+	c.releases = release.New(root)
+	return nil
+}
+
+// SetStateDir configures directory keeping update history and bad builds across restarts.
+func (c *Config) SetStateDir(dir string) error {
+	var err error
+	c.stateDir, err = filepath.Abs(dir)
+	return err
+}
+
+// SetAuditLog configures append-only audit log of binary replacements and restarts.
+func (c *Config) SetAuditLog(path string) error {
+	var err error
+	c.auditFile, err = filepath.Abs(path)
+	return err
+}
+
+// SetAuditKey configures audit log HMAC key read from file at path.
+func (c *Config) SetAuditKey(path string) error {
+	var err error
+	c.auditKey, err = audit.ReadKey(path)
+	return err
+}
+
+// SetMetricsFile configures file child process metrics are written to in Prometheus text format.
+func (c *Config) SetMetricsFile(path string) error {
+	var err error
+	c.metricsFile, err = filepath.Abs(path)
+	return err
+}
+
+// SetKeepReleases configures number of releases kept on disk, 0 keeps all releases.
+func (c *Config) SetKeepReleases(keep int) {
+	c.keepReleases = keep
+}
+
+// SetUpdatePolicy configures when detected updates are applied.
+func (c *Config) SetUpdatePolicy(policy UpdatePolicy) {
+	c.policy = policy
+}
+
+// AddMaintenanceWindow adds a window for window update policy.
+func (c *Config) AddMaintenanceWindow(w schedule.Window) {
+	c.windows = append(c.windows, w)
+}
+
+// SetControl configures control socket path, empty path disables control interface.
+func (c *Config) SetControl(path string) error {
+	if path == "" {
+		c.control = ""
+		return nil
+	}
+	var err error
+	if c.control, err = filepath.Abs(path); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetRollout configures percentage of hosts taking an update unless source manifest sets it.
+func (c *Config) SetRollout(percent int) {
+	c.rollout = percent
+}
+
+// SetRolloutDelay configures maximum delay before applying an update, each host waits for a stable random part of it.
+func (c *Config) SetRolloutDelay(delay time.Duration) {
+	c.rolloutDelay = delay
+}
+
+// SetHostname configures host name used for rollout decisions instead of os.Hostname.
+func (c *Config) SetHostname(host string) {
+	c.host = host
+}
+
+// SetChannel configures release channel used to select artifacts from update source manifest.
+func (c *Config) SetChannel(channel string) {
+	c.channel = channel
+}
+
+// SetPin pins child executable to an exact version, newer and older versions are refused.
+func (c *Config) SetPin(version string) {
+	c.pin = version
+}
+
+// SetAllowDowngrade allows applying updates with versions older than current binary.
+func (c *Config) SetAllowDowngrade(allow bool) {
+	c.allowDowngrade = allow
+}
+
+// SetVersionArg configures argument printing binary version, i.e. --version.
+// Versions are discovered from Go build info and version sidecar files otherwise.
+func (c *Config) SetVersionArg(arg string) {
+	c.versionArg = arg
+}
+
+// SetSmokeTest configures running staged child binary with args before switching, i.e. --version.
+// Staged binary must exit with zero code within timeout.
+func (c *Config) SetSmokeTest(timeout time.Duration, args ...string) {
+	c.smokeTimeout = timeout
+	c.smoke = args
+}
+
+// SetSelfUpdateTimeout configures time limit for updated reloader to report it is ready.
+// Previous reloader binary is restored if updated one doesn't start in time.
+func (c *Config) SetSelfUpdateTimeout(timeout time.Duration) {
+	c.selfUpdateTimeout = timeout
+}
+
+// SetHandover configures passing running child to updated reloader on self update instead of restarting it.
+// Exit status of adopted child is always unknown, see WithHandover.
+func (c *Config) SetHandover(handover bool) {
+	c.handover = handover
+}
+
+// SetService configures service name reloader daemon is registered with.
+func (c *Config) SetService(name string) {
+	c.service = name
+}
+
+// SetReadyMarker requires <name>.ready marker files for staged updates in staging directory.
+// Staged files must be unchanged between two consecutive checks otherwise.
+func (c *Config) SetReadyMarker(required bool) {
+	c.readyMarker = required
+}
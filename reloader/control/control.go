@@ -0,0 +1,194 @@
+// Package control implements reloader control interface over a unix socket.
+// Each connection carries a single JSON request and a single JSON response.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is returned by Call when nothing listens on control socket.
+var ErrUnavailable = errors.New("control socket is not available")
+
+// Request is a control command with arguments.
+type Request struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// Response carries command result or error message.
+type Response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Handler executes a control command and returns JSON-serializable result.
+type Handler func(ctx context.Context, args []string) (interface{}, error)
+
+// Server serves control commands on a unix socket.
+type Server struct {
+	path     string
+	listener net.Listener
+	handlers map[string]Handler
+	wg       sync.WaitGroup
+	// closes listener and removes socket once, after Stop socket path may belong to updated reloader
+	stopOnce sync.Once
+	// closed by Close to close open connections and cancel running commands
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// socketMode restricts control socket access to reloader user.
+const socketMode = 0600
+
+// requestTimeout limits reading a request and writing a response, so idle clients don't hold connections.
+var requestTimeout = 10 * time.Second
+
+// Listen creates control socket accessible by current user only, removing stale socket file left by a terminated
+// process.
+func Listen(path string, handlers map[string]Handler) (*Server, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := listenPrivate(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{path: path, listener: l, handlers: handlers, closing: make(chan struct{})}, nil
+}
+
+// listenPrivate creates unix socket at path never accessible by other users. Socket is created with umask
+// permissions, so it is created in a private directory, restricted and moved to path. File mode doesn't restrict
+// socket access on Windows.
+func listenPrivate(path string) (net.Listener, error) {
+	if runtime.GOOS == "windows" {
+		return net.Listen("unix", path)
+	}
+	// temporary directory is created with 0700 mode
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".control")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	tmp := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// listener can't remove moved socket, see Server.Stop
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, socketMode); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve accepts connections until server is closed.
+func (s *Server) Serve(ctx context.Context) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle reads a request from connection and writes handler response. Connection is closed and command is
+// cancelled when ctx is done or server is closed.
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+		_ = conn.Close()
+	}()
+	var req Request
+	var resp Response
+	_ = conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		resp.Error = err.Error()
+	} else if handler, ok := s.handlers[req.Command]; !ok {
+		resp.Error = "unknown command: " + req.Command
+	} else if result, err := handler(ctx, req.Args); err != nil {
+		resp.Error = err.Error()
+	} else if resp.Result, err = json.Marshal(result); err != nil {
+		resp.Error = err.Error()
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(requestTimeout))
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+// Stop stops accepting connections and removes socket without waiting for running commands.
+func (s *Server) Stop() error {
+	var err error
+	s.stopOnce.Do(func() {
+		err = s.listener.Close()
+		if rerr := os.Remove(s.path); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+			err = rerr
+		}
+	})
+	return err
+}
+
+// Close stops accepting connections, removes socket, closes open connections, cancels running commands and waits
+// for them.
+func (s *Server) Close() error {
+	err := s.Stop()
+	s.closeOnce.Do(func() { close(s.closing) })
+	s.wg.Wait()
+	return err
+}
+
+// Call sends a command to control socket and decodes it's result into result if it is not nil.
+func Call(ctx context.Context, path string, result interface{}, command string, args ...string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnavailable, err.Error())
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if err := json.NewEncoder(conn).Encode(Request{Command: command, Args: args}); err != nil {
+		return err
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	if result != nil && resp.Result != nil {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package control
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// newServer starts control server with a command blocking until ctx is done.
+func newServer(t *testing.T, ctx context.Context) (*Server, string) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "reloader.sock")
+	s, err := Listen(path, map[string]Handler{
+		"block": func(ctx context.Context, args []string) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ctx)
+	return s, path
+}
+
+// closed waits until f returns.
+func closed(t *testing.T, f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server is not closed")
+	}
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "reloader.sock")
+	s, err := Listen(path, map[string]Handler{
+		"echo": func(ctx context.Context, args []string) (interface{}, error) {
+			return args, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	go s.Serve(context.Background())
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := fi.Mode().Perm(); mode != socketMode {
+			t.Fatalf("socket mode %o, expected %o", mode, socketMode)
+		}
+	}
+	var result []string
+	if err := Call(context.Background(), path, &result, "echo", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0] != "a" || result[1] != "b" {
+		t.Fatalf("unexpected result %v", result)
+	}
+	if err := Call(context.Background(), path, nil, "unknown"); err == nil {
+		t.Fatal("expected error for unknown command")
+	}
+	if _, err := Listen(path, nil); err == nil {
+		t.Fatal("expected error for socket in use")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	timeout := requestTimeout
+	requestTimeout = 100 * time.Millisecond
+	defer func() { requestTimeout = timeout }()
+	s, path := newServer(t, context.Background())
+	defer func() { _ = s.Close() }()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	// idle client gets an error and connection is closed
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		t.Fatal("expected error response")
+	}
+}
+
+func TestClose(t *testing.T) {
+	s, path := newServer(t, context.Background())
+	// idle connection and running command don't block Close
+	idle, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = idle.Close() }()
+	called := make(chan error, 1)
+	go func() {
+		called <- Call(context.Background(), path, nil, "block")
+	}()
+	time.Sleep(100 * time.Millisecond)
+	closed(t, func() { _ = s.Close() })
+	if err := <-called; err == nil {
+		t.Fatal("expected error for cancelled command")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket is not removed: %v", err)
+	}
+	if _, err := idle.Read(make([]byte, 1)); err == nil {
+		t.Fatal("idle connection is not closed")
+	}
+}
+
+func TestServeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, path := newServer(t, ctx)
+	idle, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = idle.Close() }()
+	time.Sleep(100 * time.Millisecond)
+	// connections are closed when context is done
+	cancel()
+	_ = idle.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ioutil.ReadAll(idle); err != nil {
+		t.Fatal(err)
+	}
+	closed(t, func() { _ = s.Close() })
+}
+
+func TestStop(t *testing.T) {
+	s, path := newServer(t, context.Background())
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket is not removed: %v", err)
+	}
+	// socket of another server listening after Stop is not removed by Close
+	other, err := Listen(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = other.Close() }()
+	closed(t, func() { _ = s.Close() })
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+}
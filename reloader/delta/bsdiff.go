@@ -0,0 +1,101 @@
+// Package delta applies binary delta patches to executables.
+package delta
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// bsdiffMagic starts patches created by bsdiff 4.x.
+const bsdiffMagic = "BSDIFF40"
+
+// Patched binary size limits: patches producing files larger than maxGrowth times old size and at least
+// minSizeLimit are refused before allocating memory for result.
+const (
+	maxGrowth    = 8
+	minSizeLimit = 64 << 20
+)
+
+// ErrCorrupt is returned when patch data is malformed.
+var ErrCorrupt = errors.New("corrupt patch")
+
+// offtin decodes bsdiff sign-magnitude little-endian integer.
+func offtin(b []byte) int64 {
+	var x int64
+	for i := 7; i >= 0; i-- {
+		x = x<<8 | int64(b[i]&0xff)
+	}
+	if b[7]&0x80 != 0 {
+		x = -(x & 0x7fffffffffffffff)
+	}
+	return x
+}
+
+// sizeLimit returns maximum size of patched binary for old binary size.
+func sizeLimit(oldSize int64) int64 {
+	if oldSize*maxGrowth < minSizeLimit {
+		return minSizeLimit
+	}
+	return oldSize * maxGrowth
+}
+
+// Apply applies bsdiff patch to old content and returns new content.
+func Apply(old, patch []byte) ([]byte, error) {
+	if len(patch) < 32 || string(patch[:8]) != bsdiffMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrCorrupt)
+	}
+	ctrlLen := offtin(patch[8:16])
+	diffLen := offtin(patch[16:24])
+	newSize := offtin(patch[24:32])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || ctrlLen > int64(len(patch))-32 ||
+		diffLen > int64(len(patch))-32-ctrlLen {
+		return nil, fmt.Errorf("%w: bad header", ErrCorrupt)
+	}
+	if newSize > sizeLimit(int64(len(old))) {
+		return nil, fmt.Errorf("%w: new size %d exceeds limit %d", ErrCorrupt, newSize, sizeLimit(int64(len(old))))
+	}
+	body := patch[32:]
+	ctrl := bzip2.NewReader(bytes.NewReader(body[:ctrlLen]))
+	diff := bzip2.NewReader(bytes.NewReader(body[ctrlLen : ctrlLen+diffLen]))
+	extra := bzip2.NewReader(bytes.NewReader(body[ctrlLen+diffLen:]))
+
+	result := make([]byte, newSize)
+	oldSize := int64(len(old))
+	var oldPos, newPos int64
+	buf := make([]byte, 24)
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, buf); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCorrupt, err.Error())
+		}
+		add, copied, seek := offtin(buf[0:8]), offtin(buf[8:16]), offtin(buf[16:24])
+
+		// add diff bytes to old content
+		if add < 0 || add > newSize-newPos {
+			return nil, fmt.Errorf("%w: bad control block", ErrCorrupt)
+		}
+		if _, err := io.ReadFull(diff, result[newPos:newPos+add]); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCorrupt, err.Error())
+		}
+		for i := int64(0); i < add; i++ {
+			if oldPos+i >= 0 && oldPos+i < oldSize {
+				result[newPos+i] += old[oldPos+i]
+			}
+		}
+		newPos += add
+		oldPos += add
+
+		// copy extra bytes as is
+		if copied < 0 || copied > newSize-newPos {
+			return nil, fmt.Errorf("%w: bad control block", ErrCorrupt)
+		}
+		if _, err := io.ReadFull(extra, result[newPos:newPos+copied]); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCorrupt, err.Error())
+		}
+		newPos += copied
+		oldPos += seek
+	}
+	return result, nil
+}
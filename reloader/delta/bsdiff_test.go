@@ -0,0 +1,126 @@
+package delta
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"testing"
+)
+
+// bzip2-compressed blocks of a patch turning "hello old world" into "hello new world!!": single control triple
+// adding 15 diff bytes and copying 2 extra bytes.
+const (
+	testCtrl  = "QlpoOTFBWSZTWUJN5uYAAAXAAFgIoAAwzQCQGkFWbi7kinChIISbzcw="
+	testDiff  = "QlpoOTFBWSZTWbgec+kAAADgANAACAAAIKAAMM0AkaQqBu3i7kinChIXA859IA=="
+	testExtra = "QlpoOTFBWSZTWZEQxy8AAACQACAAIAAhGEbC7kinChISIhjl4A=="
+	// control triple adding 100 diff bytes
+	testBadCtrl = "QlpoOTFBWSZTWVBmVLcAAALhAEAACAAEACAAISZBmJC4u5IpwoSCgzKluA=="
+)
+
+// offout encodes bsdiff sign-magnitude little-endian integer.
+func offout(x int64) []byte {
+	b := make([]byte, 8)
+	y := x
+	if x < 0 {
+		y = -x
+	}
+	for i := 0; i < 8; i++ {
+		b[i] = byte(y >> (8 * i))
+	}
+	if x < 0 {
+		b[7] |= 0x80
+	}
+	return b
+}
+
+func decode(t *testing.T, s string) []byte {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// header returns patch header with given block lengths and new size.
+func header(ctrlLen, diffLen, newSize int64) []byte {
+	h := []byte(bsdiffMagic)
+	h = append(h, offout(ctrlLen)...)
+	h = append(h, offout(diffLen)...)
+	return append(h, offout(newSize)...)
+}
+
+// makePatch returns patch with ctrl, diff and extra blocks producing newSize bytes.
+func makePatch(ctrl, diff, extra []byte, newSize int64) []byte {
+	p := header(int64(len(ctrl)), int64(len(diff)), newSize)
+	p = append(p, ctrl...)
+	p = append(p, diff...)
+	return append(p, extra...)
+}
+
+func TestOfftin(t *testing.T) {
+	for _, x := range []int64{0, 1, -1, 255, 256, -65536, math.MaxInt64} {
+		if y := offtin(offout(x)); y != x {
+			t.Errorf("offtin(offout(%d)) = %d", x, y)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctrl, diff, extra := decode(t, testCtrl), decode(t, testDiff), decode(t, testExtra)
+	valid := makePatch(ctrl, diff, extra, 17)
+	old := []byte("hello old world")
+	testCases := []struct {
+		name     string
+		old      []byte
+		patch    []byte
+		expected string
+		err      bool
+	}{
+		{"valid", old, valid, "hello new world!!", false},
+		{"short", old, []byte(bsdiffMagic), "", true},
+		{"bad magic", old, append([]byte("BSDIFF41"), valid[8:]...), "", true},
+		{"negative ctrl length", old, append(header(-1, int64(len(diff)), 17), valid[32:]...), "", true},
+		{"negative new size", old, append(header(int64(len(ctrl)), int64(len(diff)), -1), valid[32:]...), "", true},
+		{"ctrl beyond patch", old, append(header(int64(len(valid)), 0, 17), valid[32:]...), "", true},
+		{"diff beyond patch", old, append(header(int64(len(ctrl)), math.MaxInt64, 17), valid[32:]...), "", true},
+		{"new size over limit", old, makePatch(ctrl, diff, extra, minSizeLimit+1), "", true},
+		{"new size not covered", old, makePatch(ctrl, diff, extra, 20), "", true},
+		{"add beyond new size", old, makePatch(decode(t, testBadCtrl), diff, extra, 17), "", true},
+		{"truncated diff", old, makePatch(ctrl, diff[:len(diff)/2], extra, 17), "", true},
+		{"corrupt ctrl", old, makePatch([]byte("not bzip2 data"), diff, extra, 17), "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Apply(tc.old, tc.patch)
+			if tc.err {
+				if !errors.Is(err, ErrCorrupt) {
+					t.Fatalf("expected corrupt patch error, got %q, %v", result, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestSizeLimit(t *testing.T) {
+	testCases := []struct {
+		oldSize  int64
+		expected int64
+	}{
+		{0, minSizeLimit},
+		{1 << 20, minSizeLimit},
+		{minSizeLimit / maxGrowth, minSizeLimit},
+		{100 << 20, 800 << 20},
+	}
+	for _, tc := range testCases {
+		if limit := sizeLimit(tc.oldSize); limit != tc.expected {
+			t.Errorf("sizeLimit(%d) = %d, expected %d", tc.oldSize, limit, tc.expected)
+		}
+	}
+}
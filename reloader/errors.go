@@ -0,0 +1,37 @@
+package reloader
+
+import (
+	"errors"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+)
+
+// ErrUpdated is returned by Run when reloader has started it's updated version and exited.
+var ErrUpdated = errors.New("reloader updated")
+
+// Error describes a reloader failure.
+type Error struct {
+	// failed operation
+	Op  string
+	Err error
+}
+
+// Error returns error message with failed operation.
+func (e *Error) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ChildExitError is returned by Run when child exits by itself and reloader terminates, if exit code
+// reporting is enabled.
+type ChildExitError struct {
+	Status executable.ExitStatus
+}
+
+// Error returns child exit status description.
+func (e *ChildExitError) Error() string {
+	return "child " + e.Status.String()
+}
@@ -0,0 +1,176 @@
+package reloader
+
+import (
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"time"
+)
+
+// Event is a reloader lifecycle event delivered to observers.
+type Event interface {
+	// Time returns event occurrence time.
+	Time() time.Time
+}
+
+// Observer receives reloader lifecycle events.
+type Observer interface {
+	// OnEvent is called synchronously from reloader loop and child waiter, so it should not block. It may call Stop
+	// or AddObserver, but not methods waiting for reloader loop, i.e. Status or Apply.
+	OnEvent(e Event)
+}
+
+// ObserverFunc is an adapter to use ordinary functions as observers.
+type ObserverFunc func(e Event)
+
+// OnEvent calls f(e).
+func (f ObserverFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// Timestamp keeps event occurrence time.
+type Timestamp struct {
+	At time.Time
+}
+
+// Time returns event occurrence time.
+func (t Timestamp) Time() time.Time {
+	return t.At
+}
+
+// ChildStarted is emitted after child process start.
+type ChildStarted struct {
+	Timestamp
+	PID      int
+	Path     string
+	Checksum string
+	// child binary version and Go build metadata, if known
+	Version string
+	Build   *executable.BuildInfo
+}
+
+// ChildExited is emitted after child process exit.
+type ChildExited struct {
+	Timestamp
+	PID int
+	// process exit code, -1 if process is terminated by signal or is adopted, see WithHandover
+	Code int
+	// name of signal terminated the process
+	Signal string
+	// full exit status with resource usage and run duration
+	Status executable.ExitStatus
+}
+
+// UpdateDetected is emitted when a new binary is found in staging directory.
+type UpdateDetected struct {
+	Timestamp
+	// path to new binary
+	Path     string
+	Checksum string
+	// new binary version and Go build metadata, if known before fetch
+	Version string
+	Build   *executable.BuildInfo
+}
+
+// Switched is emitted after child binary is replaced with a new one.
+type Switched struct {
+	Timestamp
+	Path string
+	// previous and new binary checksum
+	From string
+	To   string
+	// new binary version and Go build metadata, if known
+	Version string
+	Build   *executable.BuildInfo
+}
+
+// SwitchFailed is emitted when child binary replacement fails.
+type SwitchFailed struct {
+	Timestamp
+	Path string
+	Err  error
+}
+
+// SelfUpdateStarted is emitted when reloader starts updating itself.
+type SelfUpdateStarted struct {
+	Timestamp
+	// path to new reloader binary
+	Path string
+}
+
+// SelfUpdateFailed is emitted when updated reloader doesn't report it is ready and previous binary is restored.
+type SelfUpdateFailed struct {
+	Timestamp
+	// path to new reloader binary
+	Path string
+	Err  error
+}
+
+// now returns current event timestamp.
+func now() Timestamp {
+	return Timestamp{At: time.Now()}
+}
+
+// channelObserver delivers events to a buffered channel, dropping events when the buffer is full.
+type channelObserver chan Event
+
+// OnEvent sends an event to channel without blocking.
+func (c channelObserver) OnEvent(e Event) {
+	select {
+	case c <- e:
+	default:
+	}
+}
+
+// AddObserver registers a lifecycle events observer.
+func (r *Reloader) AddObserver(o Observer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observers = append(r.observers, o)
+}
+
+// Events returns a channel receiving lifecycle events. Events are dropped if channel buffer is full.
+// Channel is closed when Run returns.
+func (r *Reloader) Events() <-chan Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events == nil {
+		r.events = make(channelObserver, 64)
+		r.observers = append(r.observers, r.events)
+	}
+	return r.events
+}
+
+// emit delivers an event to all registered observers.
+// Observers are called without holding reloader lock, except events channel closed under the lock.
+func (r *Reloader) emit(e Event) {
+	r.mu.Lock()
+	observers := make([]Observer, 0, len(r.observers))
+	for _, o := range r.observers {
+		if c, ok := o.(channelObserver); ok {
+			// sending to channel doesn't block
+			c.OnEvent(e)
+			continue
+		}
+		observers = append(observers, o)
+	}
+	r.mu.Unlock()
+	for _, o := range observers {
+		o.OnEvent(e)
+	}
+}
+
+// closeEvents closes events channel and unregisters it.
+func (r *Reloader) closeEvents() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events == nil {
+		return
+	}
+	for i, o := range r.observers {
+		if o == Observer(r.events) {
+			r.observers = append(r.observers[:i], r.observers[i+1:]...)
+			break
+		}
+	}
+	close(r.events)
+	r.events = nil
+}
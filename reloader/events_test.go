@@ -0,0 +1,37 @@
+package reloader
+
+import (
+	"testing"
+	"time"
+)
+
+// TestEmitUnlocked checks that observers may call reloader methods taking reloader lock.
+func TestEmitUnlocked(t *testing.T) {
+	r := &Reloader{}
+	events := r.Events()
+	var received []Event
+	r.AddObserver(ObserverFunc(func(e Event) {
+		received = append(received, e)
+		r.AddObserver(ObserverFunc(func(Event) {}))
+		r.Stop()
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.emit(ChildStarted{Timestamp: now(), PID: 1})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("observer calling reloader methods is deadlocked")
+	}
+	if len(received) != 1 {
+		t.Fatalf("observer received %d events", len(received))
+	}
+	if e, ok := (<-events).(ChildStarted); !ok || e.PID != 1 {
+		t.Fatalf("unexpected event %#v", e)
+	}
+	r.closeEvents()
+	// events are not sent to closed channel
+	r.emit(ChildStarted{Timestamp: now(), PID: 2})
+}
@@ -0,0 +1,84 @@
+package executable
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// output returns pipe for child output to w, child writes to files directly.
+func output(w io.Writer) (*os.File, *os.File, error) {
+	if f, ok := w.(*os.File); ok {
+		return nil, f, nil
+	}
+	return os.Pipe()
+}
+
+// outputDrainTimeout limits waiting for child output copying after child exit, as child output pipes may be
+// kept open by it's own children.
+const outputDrainTimeout = 5 * time.Second
+
+// Attach copies child output from pipe to w until pipe is closed by child, then closes pipe. Nil pipe is ignored.
+func (e *Executable) Attach(pipe *os.File, w io.Writer) {
+	if pipe == nil {
+		return
+	}
+	if e.copiers == nil {
+		e.copiers = &sync.WaitGroup{}
+	}
+	copiers := e.copiers
+	copiers.Add(1)
+	go func() {
+		defer copiers.Done()
+		_, _ = io.Copy(w, pipe)
+		_ = pipe.Close()
+	}()
+}
+
+// drainOutput waits until child output is copied, see Attach.
+func (e Executable) drainOutput() {
+	if e.copiers == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		e.copiers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(outputDrainTimeout):
+	}
+}
+
+// Pipes returns read ends of child stdout and stderr pipes, nil if child writes to a file directly.
+// Both pipes are the same if child stdout and stderr are the same writer.
+func (e *Executable) Pipes() (stdout *os.File, stderr *os.File) {
+	return e.stdout, e.stderr
+}
+
+// ClosePipes closes read ends of child output pipes, i.e. when they are handed over to another process.
+func (e *Executable) ClosePipes() {
+	if e.stdout != nil {
+		_ = e.stdout.Close()
+	}
+	if e.stderr != nil && e.stderr != e.stdout {
+		_ = e.stderr.Close()
+	}
+}
+
+// Adopt makes Executable represent running process with pid started by another process at started time.
+// Child output pipes are passed separately, see Attach.
+func (e *Executable) Adopt(pid int, started time.Time, stdout, stderr *os.File) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	e.cmd = &exec.Cmd{Path: e.path, Args: append([]string{e.path}, e.args...), Process: p}
+	e.stdout, e.stderr = stdout, stderr
+	e.adopted = true
+	e.started = started
+	return nil
+}
@@ -0,0 +1,65 @@
+package executable
+
+import (
+	"debug/buildinfo"
+	"strings"
+	"time"
+)
+
+// BuildInfo describes Go build metadata embedded into a binary.
+type BuildInfo struct {
+	// Go toolchain version
+	GoVersion string `json:"go_version"`
+	// main package path
+	Path string `json:"path,omitempty"`
+	// main module version
+	Version string `json:"version,omitempty"`
+	// VCS revision and commit time
+	Revision string    `json:"revision,omitempty"`
+	Time     time.Time `json:"time,omitempty"`
+	// binary is built from modified working tree
+	Dirty bool `json:"dirty,omitempty"`
+}
+
+// ReadBuildInfo reads Go build metadata from a binary.
+func ReadBuildInfo(path string) (*BuildInfo, error) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &BuildInfo{GoVersion: info.GoVersion, Path: info.Path}
+	if v := info.Main.Version; v != "(devel)" {
+		b.Version = v
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.Time, _ = time.Parse(time.RFC3339, s.Value)
+		case "vcs.modified":
+			b.Dirty = s.Value == "true"
+		}
+	}
+	return b, nil
+}
+
+// String returns short build description, i.e. "v1.2.3 rev 0123456789ab-dirty go1.16".
+func (b *BuildInfo) String() string {
+	var parts []string
+	if b.Version != "" {
+		parts = append(parts, b.Version)
+	}
+	if b.Revision != "" {
+		rev := b.Revision
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		if b.Dirty {
+			rev += "-dirty"
+		}
+		parts = append(parts, "rev "+rev)
+	}
+	parts = append(parts, b.GoVersion)
+	return strings.Join(parts, " ")
+}
@@ -3,10 +3,13 @@ package executable
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
+	"github.com/tumb1er/go-reloader/reloader/version"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -18,8 +21,25 @@ type Executable struct {
 	checksum []byte
 	// executable last modification time
 	modified time.Time
+	// executable version, empty if unknown
+	version string
+	// Go build metadata, nil for non-Go binaries
+	build *BuildInfo
 	// program args
 	args []string
+	// additional environment variables
+	env []string
+	// files inherited by new process as fd 3, 4...
+	files []*os.File
+	// read ends of child stdout and stderr pipes, nil if child writes to a file directly
+	stdout *os.File
+	stderr *os.File
+	// process is not started by current process
+	adopted bool
+	// process start time
+	started time.Time
+	// child output copying goroutines
+	copiers *sync.WaitGroup
 	// child process handler
 	cmd *exec.Cmd
 }
@@ -52,12 +72,22 @@ func (e Executable) GetChecksum() ([]byte, error) {
 	}
 }
 
+// Staged returns an instance representing executable binary kept in staging directory.
+func (e Executable) Staged(dir string) (*Executable, error) {
+	return NewExecutable(filepath.Join(dir, filepath.Base(e.path)))
+}
+
 // Latest checks whether Executable instance is running latest version of binary kept in staging directory.
+// Known versions are compared semantically, modification time and checksum are compared otherwise.
 func (e Executable) Latest(dir string) (bool, error) {
-	p := filepath.Join(dir, filepath.Base(e.path))
-	if stage, err := NewExecutable(p); err != nil {
+	if stage, err := e.Staged(dir); err != nil {
 		return false, err
 	} else {
+		if stage.version != "" && e.version != "" {
+			if c := version.Compare(stage.version, e.version); c != 0 {
+				return c < 0, nil
+			}
+		}
 		if stage.modified.Before(e.modified) {
 			return true, nil
 		}
@@ -70,7 +100,11 @@ func (e Executable) Latest(dir string) (bool, error) {
 
 // Switch overwrites executable for staging dir with exponential back-off
 func (e Executable) Switch(dir string) error {
-	src := filepath.Join(dir, filepath.Base(e.path))
+	return e.SwitchFrom(filepath.Join(dir, filepath.Base(e.path)))
+}
+
+// SwitchFrom overwrites executable with src binary with exponential back-off
+func (e Executable) SwitchFrom(src string) error {
 	sleep := time.Second
 	total := 5
 	var err error
@@ -86,13 +120,56 @@ func (e Executable) Switch(dir string) error {
 	return err
 }
 
-// Start initializes and starts new subprocess
+// Start initializes and starts new subprocess.
+// Output to writers other than files is copied from pipes, which may be passed to another process, see Pipes.
 func (e *Executable) Start(stdout io.Writer, stderr io.Writer) error {
 	e.cmd = exec.Command(e.path, e.args...)
-	e.cmd.Stdout = stdout
-	e.cmd.Stderr = stderr
+	e.cmd.ExtraFiles = e.files
+	if len(e.env) > 0 {
+		e.cmd.Env = append(os.Environ(), e.env...)
+	}
 	e.setCmdFlags()
-	return e.cmd.Start()
+	var err error
+	var outW, errW *os.File
+	if e.stdout, outW, err = output(stdout); err != nil {
+		return err
+	}
+	e.stderr, errW = e.stdout, outW
+	if stderr != stdout {
+		if e.stderr, errW, err = output(stderr); err != nil {
+			e.ClosePipes()
+			return err
+		}
+	}
+	e.cmd.Stdout, e.cmd.Stderr = outW, errW
+	e.started = time.Now()
+	err = e.cmd.Start()
+	// write ends are kept by child process only
+	if e.stdout != nil {
+		CloseFile(outW)
+	}
+	if e.stderr != nil && e.stderr != e.stdout {
+		CloseFile(errW)
+	}
+	if err != nil {
+		e.ClosePipes()
+		return err
+	}
+	e.Attach(e.stdout, stdout)
+	if e.stderr != e.stdout {
+		e.Attach(e.stderr, stderr)
+	}
+	return nil
+}
+
+// SetFiles sets files inherited by new subprocess as file descriptors 3, 4 and so on. Not supported on Windows.
+func (e *Executable) SetFiles(files ...*os.File) {
+	e.files = files
+}
+
+// SetEnv adds environment variables in key=value form for new subprocess.
+func (e *Executable) SetEnv(env ...string) {
+	e.env = append(e.env, env...)
 }
 
 func (e *Executable) Release() error {
@@ -110,19 +187,70 @@ func (e Executable) Terminate(tree bool) error {
 	return killer()
 }
 
-// Wait waits for child process exit and return exit code
-func (e Executable) Wait() (int, error) {
+// Wait waits for child process exit and copying of it's remaining output, and returns its exit status.
+// Exit code of adopted process is unknown, status is marked as unknown with -1 exit code.
+func (e Executable) Wait() (ExitStatus, error) {
+	if e.adopted {
+		status, err := e.waitAdopted()
+		e.drainOutput()
+		return status, err
+	}
 	if state, err := e.cmd.Process.Wait(); err != nil {
-		return 0, err
+		return ExitStatus{}, err
 	} else {
-		return state.ExitCode(), nil
+		e.drainOutput()
+		return newExitStatus(state, e.started), nil
 	}
 }
 
+// Started returns process start time.
+func (e Executable) Started() time.Time {
+	return e.started
+}
+
+// Modified returns executable modification time.
+func (e Executable) Modified() time.Time {
+	return e.modified
+}
+
+// Pid returns child process id.
+func (e Executable) Pid() int {
+	return e.cmd.Process.Pid
+}
+
+// Checksum returns hex-encoded executable checksum.
+func (e Executable) Checksum() string {
+	return hex.EncodeToString(e.checksum)
+}
+
 func (e Executable) Path() string {
 	return e.path
 }
 
+// Version returns executable version, empty if unknown.
+func (e Executable) Version() string {
+	return e.version
+}
+
+// BuildInfo returns Go build metadata, nil if binary doesn't contain it.
+func (e Executable) BuildInfo() *BuildInfo {
+	return e.build
+}
+
+// Describe returns executable name with version and build details for logging.
+func (e Executable) Describe() string {
+	s := e.String()
+	if e.version != "" && (e.build == nil || e.build.Version != e.version) {
+		s += " " + e.version
+	}
+	if e.build != nil {
+		s += " " + e.build.String()
+	} else if e.version == "" {
+		s += " sha256 " + e.Checksum()[:12]
+	}
+	return s
+}
+
 // NewExecutable initializes an instance representing executable file.
 func NewExecutable(path string, args ...string) (*Executable, error) {
 	var err error
@@ -139,5 +267,7 @@ func NewExecutable(path string, args ...string) (*Executable, error) {
 	if e.checksum, err = e.GetChecksum(); err != nil {
 		return nil, err
 	}
+	e.build, _ = ReadBuildInfo(path)
+	e.version = readVersion(path, e.Checksum(), e.build)
 	return e, nil
 }
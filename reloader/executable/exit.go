@@ -0,0 +1,84 @@
+package executable
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ExitStatus describes how a process exited.
+type ExitStatus struct {
+	// process exit code, -1 if process is terminated by signal or exit code is unknown
+	Code int `json:"code"`
+	// process is not waited for, i.e. adopted, so exit code and signal are unknown
+	Unknown bool `json:"unknown,omitempty"`
+	// name and number of signal terminated the process
+	Signal       string `json:"signal,omitempty"`
+	SignalNumber int    `json:"signal_number,omitempty"`
+	// process dumped core
+	CoreDump bool `json:"core_dump,omitempty"`
+	// CPU time spent in user and system mode
+	UserTime   time.Duration `json:"user_time"`
+	SystemTime time.Duration `json:"system_time"`
+	// maximum resident set size in bytes, 0 if unknown
+	MaxRSS int64 `json:"max_rss,omitempty"`
+	// time passed since process start
+	Duration time.Duration `json:"duration"`
+}
+
+// newExitStatus returns exit status of a process waited for.
+func newExitStatus(state *os.ProcessState, started time.Time) ExitStatus {
+	s := ExitStatus{
+		Code:       state.ExitCode(),
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		Duration:   time.Since(started),
+	}
+	exitDetails(state, &s)
+	return s
+}
+
+// Success reports whether process exited with zero code.
+func (s ExitStatus) Success() bool {
+	return s.Code == 0 && s.Signal == "" && !s.Unknown
+}
+
+// Failure reports whether process is known to exit with non-zero code or by signal.
+func (s ExitStatus) Failure() bool {
+	return !s.Success() && !s.Unknown
+}
+
+// ShellCode returns exit code as reported by shells: 128 + signal number for processes terminated by signal.
+// Unknown exit status is reported as 0.
+func (s ExitStatus) ShellCode() int {
+	if s.Unknown {
+		return 0
+	}
+	if s.SignalNumber > 0 {
+		return 128 + s.SignalNumber
+	}
+	if s.Code < 0 {
+		return 1
+	}
+	return s.Code
+}
+
+// String describes exit status for logging.
+func (s ExitStatus) String() string {
+	var msg string
+	switch {
+	case s.Unknown:
+		msg = "exit code unknown"
+	case s.Signal != "" && s.CoreDump:
+		msg = fmt.Sprintf("terminated by signal %s (core dumped)", s.Signal)
+	case s.Signal != "":
+		msg = fmt.Sprintf("terminated by signal %s", s.Signal)
+	default:
+		msg = fmt.Sprintf("exit code %d", s.Code)
+	}
+	msg += fmt.Sprintf(" after %s, cpu %s", s.Duration.Round(time.Millisecond), (s.UserTime + s.SystemTime).Round(time.Millisecond))
+	if s.MaxRSS > 0 {
+		msg += fmt.Sprintf(", max rss %d KiB", s.MaxRSS/1024)
+	}
+	return msg
+}
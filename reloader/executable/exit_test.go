@@ -0,0 +1,100 @@
+package executable
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runScript runs shell script and waits for it's exit.
+func runScript(t *testing.T, script string) ExitStatus {
+	if runtime.GOOS == "windows" {
+		t.Skip("exit details are reported for shell scripts")
+	}
+	e, err := NewExecutable("/bin/sh", "-c", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Start(ioutil.Discard, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	s, err := e.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestExitStatus(t *testing.T) {
+	testCases := []struct {
+		name   string
+		script string
+		code   int
+		signal string
+		number int
+		shell  int
+	}{
+		{"success", "exit 0", 0, "", 0, 0},
+		{"exit code", "exit 3", 3, "", 0, 3},
+		{"signal", "kill -TERM $$", -1, "terminated", 15, 143},
+		// core dumps are disabled, so core dump flag is not set
+		{"core", "ulimit -c 0; kill -ABRT $$", -1, "aborted", 6, 134},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := runScript(t, tc.script)
+			if s.Code != tc.code || s.Signal != tc.signal || s.SignalNumber != tc.number || s.CoreDump {
+				t.Fatalf("unexpected exit status %+v", s)
+			}
+			if s.ShellCode() != tc.shell {
+				t.Fatalf("shell code %d, expected %d", s.ShellCode(), tc.shell)
+			}
+			if s.Success() != (tc.shell == 0) || s.Failure() != (tc.shell != 0) {
+				t.Fatalf("success %v, failure %v", s.Success(), s.Failure())
+			}
+		})
+	}
+}
+
+func TestExitStatusUsage(t *testing.T) {
+	s := runScript(t, "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done; sleep 0.1")
+	if s.Duration < 100*time.Millisecond {
+		t.Fatalf("run duration %s", s.Duration)
+	}
+	if s.UserTime+s.SystemTime <= 0 {
+		t.Fatalf("cpu time %s", s.UserTime+s.SystemTime)
+	}
+	// resource usage is reported for process tree waited for
+	if s.MaxRSS <= 0 {
+		t.Fatalf("max rss %d", s.MaxRSS)
+	}
+}
+
+func TestExitStatusString(t *testing.T) {
+	testCases := []struct {
+		status   ExitStatus
+		expected string
+	}{
+		{ExitStatus{Code: 3, Duration: time.Second, UserTime: time.Millisecond}, "exit code 3 after 1s, cpu 1ms"},
+		{ExitStatus{Code: -1, Signal: "killed", SignalNumber: 9, MaxRSS: 2048}, "terminated by signal killed after 0s, cpu 0s, max rss 2 KiB"},
+		{ExitStatus{Code: -1, Signal: "segmentation fault", SignalNumber: 11, CoreDump: true},
+			"terminated by signal segmentation fault (core dumped) after 0s, cpu 0s"},
+		{ExitStatus{Code: -1, Unknown: true, Duration: time.Minute}, "exit code unknown after 1m0s, cpu 0s"},
+	}
+	for _, tc := range testCases {
+		if msg := tc.status.String(); msg != tc.expected {
+			t.Errorf("%q, expected %q", msg, tc.expected)
+		}
+	}
+	// unknown exit status is neither success nor failure
+	s := ExitStatus{Code: -1, Unknown: true}
+	if s.Success() || s.Failure() || s.ShellCode() != 0 {
+		t.Fatalf("unknown exit status %+v", s)
+	}
+	// exit code unknown for other reasons is reported as generic failure
+	if s := (ExitStatus{Code: -1}); s.ShellCode() != 1 || !strings.Contains(s.String(), "exit code -1") {
+		t.Fatalf("shell code %d, %s", s.ShellCode(), s)
+	}
+}
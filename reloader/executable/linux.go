@@ -3,9 +3,17 @@
 package executable
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"syscall"
+	"time"
 )
 
+// adoptedPollInterval is an interval of checking whether adopted process is running.
+const adoptedPollInterval = 200 * time.Millisecond
+
 // setCmdFlags sets new process group flag
 func (e *Executable) setCmdFlags() {
 	e.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
@@ -20,3 +28,39 @@ func (e *Executable) terminateProcess() error {
 func (e *Executable) terminateProcessTree() error {
 	return syscall.Kill(-e.cmd.Process.Pid, syscall.SIGTERM)
 }
+
+// exitDetails sets signal that terminated the process, core dump flag and maximum resident set size
+func exitDetails(state *os.ProcessState, s *ExitStatus) {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		s.Signal = ws.Signal().String()
+		s.SignalNumber = int(ws.Signal())
+		s.CoreDump = ws.CoreDump()
+	}
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		// maxrss is measured in kilobytes
+		s.MaxRSS = ru.Maxrss * 1024
+	}
+}
+
+// Running checks whether process with pid exists.
+func Running(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+// waitAdopted polls adopted process until it exits or becomes a zombie, as it can't be waited for.
+// Only run duration of adopted process is known.
+func (e *Executable) waitAdopted() (ExitStatus, error) {
+	pid := e.cmd.Process.Pid
+	for {
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+			return ExitStatus{Code: -1, Unknown: true, Duration: time.Since(e.started)}, nil
+		}
+		if stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+			// state follows command name in parentheses
+			if fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:])); len(fields) > 0 && fields[0] == "Z" {
+				return ExitStatus{Code: -1, Unknown: true, Duration: time.Since(e.started)}, nil
+			}
+		}
+		time.Sleep(adoptedPollInterval)
+	}
+}
@@ -29,3 +29,58 @@ func PerformSwitch(src, dst string) error {
 	}
 	return nil
 }
+
+// CopyFile copies src binary to a new executable file dst.
+func CopyFile(src, dst string) error {
+	if r, err := os.Open(src); err != nil {
+		return err
+	} else {
+		defer CloseFile(r)
+		if w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0751); err != nil {
+			return err
+		} else {
+			defer CloseFile(w)
+			if _, err := io.Copy(w, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BackupSuffix is appended to replaced binary path to keep it's previous version.
+const BackupSuffix = ".bak"
+
+// Backup copies binary at path to path.bak, replacing previous backup.
+func Backup(path string) error {
+	if err := os.Remove(path + BackupSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return CopyFile(path, path+BackupSuffix)
+}
+
+// Replace replaces dst binary with a copy of src, keeping previous binary as dst.bak.
+// New binary is copied to a temporary file first and then renamed, so a running binary is never overwritten.
+func Replace(src, dst string) error {
+	tmp := dst + ".new"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := CopyFile(src, tmp); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dst); err == nil {
+		if err := os.Chmod(tmp, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(dst, dst+BackupSuffix); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Rename(dst+BackupSuffix, dst)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package executable
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// elfMachines maps GOARCH to ELF machine and class.
+var elfMachines = map[string]struct {
+	machine elf.Machine
+	class   elf.Class
+}{
+	"386":      {elf.EM_386, elf.ELFCLASS32},
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64},
+	"arm":      {elf.EM_ARM, elf.ELFCLASS32},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64},
+	"ppc64":    {elf.EM_PPC64, elf.ELFCLASS64},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64},
+}
+
+// peMachines maps GOARCH to PE machine.
+var peMachines = map[string]uint16{
+	"386":   pe.IMAGE_FILE_MACHINE_I386,
+	"amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+	"arm":   pe.IMAGE_FILE_MACHINE_ARMNT,
+	"arm64": pe.IMAGE_FILE_MACHINE_ARM64,
+}
+
+// machoCpus maps GOARCH to Mach-O cpu type.
+var machoCpus = map[string]macho.Cpu{
+	"386":   macho.Cpu386,
+	"amd64": macho.CpuAmd64,
+	"arm":   macho.CpuArm,
+	"arm64": macho.CpuArm64,
+}
+
+// CheckArch checks that binary at path is an executable for current OS and architecture.
+// Scripts starting with #! are not checked, as well as binaries on unknown architectures.
+func CheckArch(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer CloseFile(f)
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return fmt.Errorf("%s is not an executable: %s", path, err.Error())
+	}
+	if bytes.Equal(magic, []byte("#!")) {
+		return nil
+	}
+	switch runtime.GOOS {
+	case "windows":
+		return checkPE(f)
+	case "darwin", "ios":
+		return checkMachO(f)
+	default:
+		return checkELF(f)
+	}
+}
+
+// checkELF checks ELF header machine and class.
+func checkELF(r io.ReaderAt) error {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("not an ELF executable: %s", err.Error())
+	}
+	if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN {
+		return fmt.Errorf("ELF file type is %s, not an executable", f.Type)
+	}
+	want, ok := elfMachines[runtime.GOARCH]
+	if !ok {
+		return nil
+	}
+	if f.Machine != want.machine || f.Class != want.class {
+		return fmt.Errorf("ELF binary is %s %s, host is %s", f.Machine, f.Class, runtime.GOARCH)
+	}
+	return nil
+}
+
+// checkPE checks PE header machine.
+func checkPE(r io.ReaderAt) error {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("not a PE executable: %s", err.Error())
+	}
+	if f.Characteristics&pe.IMAGE_FILE_EXECUTABLE_IMAGE == 0 || f.Characteristics&pe.IMAGE_FILE_DLL != 0 {
+		return fmt.Errorf("PE file is not an executable image")
+	}
+	want, ok := peMachines[runtime.GOARCH]
+	if !ok {
+		return nil
+	}
+	if f.Machine != want {
+		return fmt.Errorf("PE binary machine is %#x, host is %s", f.Machine, runtime.GOARCH)
+	}
+	return nil
+}
+
+// checkMachO checks Mach-O header cpu, universal binaries must contain a slice for host.
+func checkMachO(r io.ReaderAt) error {
+	want, known := machoCpus[runtime.GOARCH]
+	if fat, err := macho.NewFatFile(r); err == nil {
+		for _, a := range fat.Arches {
+			if !known || a.Cpu == want {
+				return nil
+			}
+		}
+		return fmt.Errorf("universal binary doesn't contain %s", runtime.GOARCH)
+	}
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("not a Mach-O executable: %s", err.Error())
+	}
+	if f.Type != macho.TypeExec {
+		return fmt.Errorf("Mach-O file type is %s, not an executable", f.Type)
+	}
+	if known && f.Cpu != want {
+		return fmt.Errorf("Mach-O binary is %s, host is %s", f.Cpu, runtime.GOARCH)
+	}
+	return nil
+}
+
+// Smoke runs binary at path with args from it's directory and checks that it exits successfully within timeout.
+func Smoke(path string, args []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Dir = filepath.Dir(path)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return fmt.Errorf("smoke test: %s: %s", err.Error(), out)
+		}
+		return fmt.Errorf("smoke test: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package executable
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/tumb1er/go-reloader/reloader/version"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionSuffix is appended to executable path for version sidecar files.
+const VersionSuffix = ".version"
+
+// probeTimeout limits version probe execution time.
+const probeTimeout = 5 * time.Second
+
+// versionPattern matches a semantic version in version probe output.
+var versionPattern = regexp.MustCompile(`v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?`)
+
+// probed caches version probe results by executable checksum.
+var probed sync.Map
+
+// ReadVersion discovers executable version from version sidecar file or Go build info, empty if unknown.
+func ReadVersion(path string) string {
+	build, _ := ReadBuildInfo(path)
+	sum, _ := fileChecksum(path)
+	return readVersion(path, sum, build)
+}
+
+// readVersion returns version of binary with checksum from sidecar file or build info if it is not nil.
+// Sidecar file contains version and optionally checksum of binary it is written for. Sidecar with checksum
+// takes precedence over build info and is ignored if binary is replaced without updating it, sidecar without
+// checksum (i.e. written by publisher to staging directory) is used only if build info has no version.
+func readVersion(path, checksum string, build *BuildInfo) string {
+	var unverified string
+	if data, err := ioutil.ReadFile(path + VersionSuffix); err == nil {
+		fields := strings.Fields(string(data))
+		switch {
+		case len(fields) == 2 && fields[1] == checksum && valid(fields[0]):
+			return fields[0]
+		case len(fields) == 1 && valid(fields[0]):
+			unverified = fields[0]
+		}
+	}
+	if build != nil && valid(build.Version) {
+		return build.Version
+	}
+	return unverified
+}
+
+// WriteVersion writes version sidecar file with checksum of executable, removing it if version is empty.
+func WriteVersion(path, v string) error {
+	if v == "" {
+		if err := os.Remove(path + VersionSuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+VersionSuffix, []byte(v+" "+sum+"\n"), 0644)
+}
+
+// fileChecksum returns hex-encoded checksum of file at path.
+func fileChecksum(path string) (string, error) {
+	sum, err := Executable{path: path}.GetChecksum()
+	return hex.EncodeToString(sum), err
+}
+
+// valid checks whether v is a semantic version.
+func valid(v string) bool {
+	if v == "" {
+		return false
+	}
+	_, err := version.Parse(v)
+	return err == nil
+}
+
+// ProbeVersion runs executable with arg, i.e. --version, and sets version found in it's output
+// if version is not discovered yet. Results are cached by executable checksum.
+func (e *Executable) ProbeVersion(arg string) error {
+	if e.version != "" || arg == "" {
+		return nil
+	}
+	if v, ok := probed.Load(e.Checksum()); ok {
+		e.version = v.(string)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, e.path, arg).Output()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	// failed probes are cached too, so hanging binaries are not run on each check
+	e.version = versionPattern.FindString(string(out))
+	probed.Store(e.Checksum(), e.version)
+	if err != nil && e.version == "" {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package executable
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "app")
+	if err := ioutil.WriteFile(path, []byte("binary"), 0751); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := fileChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		sidecar  string
+		build    *BuildInfo
+		expected string
+	}{
+		{"no version", "", nil, ""},
+		{"build info", "", &BuildInfo{Version: "v1.2.0"}, "v1.2.0"},
+		{"devel build", "", &BuildInfo{Version: "(devel)"}, ""},
+		{"verified sidecar", "1.3.0 " + sum + "\n", &BuildInfo{Version: "v1.2.0"}, "1.3.0"},
+		{"stale sidecar", "1.3.0 0123456789abcdef\n", &BuildInfo{Version: "v1.2.0"}, "v1.2.0"},
+		{"stale sidecar without build info", "1.3.0 0123456789abcdef\n", nil, ""},
+		{"unverified sidecar", "1.3.0\n", nil, "1.3.0"},
+		{"unverified sidecar and build info", "1.3.0\n", &BuildInfo{Version: "v1.2.0"}, "v1.2.0"},
+		{"invalid sidecar", "latest\n", nil, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = os.Remove(path + VersionSuffix)
+			if tc.sidecar != "" {
+				if err := ioutil.WriteFile(path+VersionSuffix, []byte(tc.sidecar), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if v := readVersion(path, sum, tc.build); v != tc.expected {
+				t.Fatalf("version %q, expected %q", v, tc.expected)
+			}
+		})
+	}
+}
+
+func TestWriteVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "app")
+	if err := ioutil.WriteFile(path, []byte("binary"), 0751); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteVersion(path, "1.2.0"); err != nil {
+		t.Fatal(err)
+	}
+	if v := ReadVersion(path); v != "1.2.0" {
+		t.Fatalf("version %q, expected 1.2.0", v)
+	}
+	// binary replaced without updating sidecar
+	if err := ioutil.WriteFile(path, []byte("other binary"), 0751); err != nil {
+		t.Fatal(err)
+	}
+	if v := ReadVersion(path); v != "" {
+		t.Fatalf("stale version %q is used", v)
+	}
+	if err := WriteVersion(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + VersionSuffix); !os.IsNotExist(err) {
+		t.Fatalf("sidecar is not removed: %v", err)
+	}
+}
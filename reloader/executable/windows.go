@@ -3,7 +3,9 @@
 package executable
 
 import (
+	"errors"
 	"golang.org/x/sys/windows"
+	"os"
 	"os/exec"
 	"strconv"
 	"syscall"
@@ -47,3 +49,31 @@ func (e *Executable) terminateProcessTree() error {
 	}
 	return nil
 }
+
+// exitDetails is a stub, Windows processes are not terminated with signals and don't report memory usage
+//noinspection GoUnusedParameter
+func exitDetails(state *os.ProcessState, s *ExitStatus) {
+}
+
+// stillActive is an exit code of running process.
+const stillActive = 259
+
+// Running checks whether process with pid exists.
+func Running(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer func() { _ = windows.CloseHandle(h) }()
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
+
+// waitAdopted is a stub, child output pipes can't be inherited on Windows, so processes are not adopted
+//noinspection GoUnusedParameter
+func (e *Executable) waitAdopted() (ExitStatus, error) {
+	return ExitStatus{}, errors.New("adopted processes are not supported on Windows")
+}
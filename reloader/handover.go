@@ -0,0 +1,155 @@
+package reloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// handoverEnv passes handover state file path to updated reloader.
+const handoverEnv = "RELOADER_HANDOVER"
+
+// firstInheritedFd is a descriptor of first file inherited by updated reloader.
+const firstInheritedFd = 3
+
+// handoverFile is a handover state file name in private handover directory.
+const handoverFile = "handover.json"
+
+// handoverState describes running child adopted by updated reloader.
+type handoverState struct {
+	PID     int      `json:"pid"`
+	Path    string   `json:"path"`
+	Args    []string `json:"args"`
+	Release string   `json:"release,omitempty"`
+	// child process start time
+	Started time.Time `json:"started"`
+	// inherited descriptors of child stdout and stderr pipes, 0 if child writes to a file directly
+	Stdout int `json:"stdout,omitempty"`
+	Stderr int `json:"stderr,omitempty"`
+	// number of inherited descriptors
+	Files int `json:"files"`
+}
+
+// inheritedFiles returns files inherited from previous reloader as described by handover state.
+func (s handoverState) inheritedFiles() []*os.File {
+	files := make([]*os.File, s.Files)
+	for i := range files {
+		fd := firstInheritedFd + i
+		files[i] = os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	}
+	return files
+}
+
+// file returns inherited file with descriptor fd, nil if fd is 0.
+func (s handoverState) file(files []*os.File, fd int) *os.File {
+	if fd < firstInheritedFd || fd-firstInheritedFd >= len(files) {
+		return nil
+	}
+	return files[fd-firstInheritedFd]
+}
+
+// writeHandover saves running child state for updated reloader and returns state file path and
+// child output pipes to be inherited by updater. State file is written to a new temporary directory accessible
+// by current user only, see removeHandover.
+func (r *Reloader) writeHandover() (string, []*os.File, error) {
+	s := handoverState{
+		PID:     r.cmd.Pid(),
+		Path:    r.cmd.Path(),
+		Args:    r.args,
+		Release: r.release,
+		Started: r.cmd.Started(),
+	}
+	var files []*os.File
+	stdout, stderr := r.cmd.Pipes()
+	if stdout != nil {
+		files = append(files, stdout)
+		s.Stdout = firstInheritedFd + len(files) - 1
+	}
+	if stderr == stdout {
+		s.Stderr = s.Stdout
+	} else if stderr != nil {
+		files = append(files, stderr)
+		s.Stderr = firstInheritedFd + len(files) - 1
+	}
+	s.Files = len(files)
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", nil, err
+	}
+	// temporary directory is created with 0700 mode
+	dir, err := ioutil.TempDir("", "reloader")
+	if err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(dir, handoverFile)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return path, files, nil
+}
+
+// removeHandover removes handover state file and it's directory.
+func removeHandover(path string) {
+	_ = os.Remove(path)
+	// directory is not removed if it is not empty, i.e. state path is not written by writeHandover
+	_ = os.Remove(filepath.Dir(path))
+}
+
+// readHandover reads state of a child handed over by previous reloader, nil if reloader is not started
+// by self update in handover mode. State file is removed after reading.
+func readHandover() (*handoverState, error) {
+	path := os.Getenv(handoverEnv)
+	if path == "" {
+		return nil, nil
+	}
+	// child process must not see handover state
+	if err := os.Unsetenv(handoverEnv); err != nil {
+		return nil, err
+	}
+	defer removeHandover(path)
+	return loadHandover(path)
+}
+
+// loadHandover reads handover state file.
+func loadHandover(path string) (*handoverState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s handoverState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// adoptChild starts supervising child process handed over by previous reloader. Adopted child is not a subprocess
+// of reloader, so it's exit status is always unknown, see executable.ExitStatus.
+func (r *Reloader) adoptChild(ctx context.Context, s *handoverState) (<-chan executable.ExitStatus, context.CancelFunc, error) {
+	var err error
+	if r.cmd, err = executable.NewExecutable(s.Path, s.Args...); err != nil {
+		return nil, nil, err
+	}
+	files := s.inheritedFiles()
+	stdout, stderr := s.file(files, s.Stdout), s.file(files, s.Stderr)
+	if err := r.cmd.Adopt(s.PID, s.Started, stdout, stderr); err != nil {
+		return nil, nil, err
+	}
+	r.cmd.Attach(stdout, r.stdout)
+	if stderr != stdout {
+		r.cmd.Attach(stderr, r.stderr)
+	}
+	if err := r.cmd.ProbeVersion(r.versionArg); err != nil {
+		r.logger.Printf("child version probe: %s", err.Error())
+	}
+	r.logger.Printf("child adopted: %s pid %d", r.cmd.Describe(), s.PID)
+	r.release = s.Release
+	ch, stopChild := r.watchChild(ctx)
+	return ch, stopChild, nil
+}
@@ -0,0 +1,120 @@
+package reloader
+
+import (
+	"bytes"
+	"context"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestHandover(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("handover is supported on Linux only")
+	}
+	r := newTestReloader()
+	var err error
+	if r.cmd, err = executable.NewExecutable("/bin/sh", "-c", "exec sleep 10"); err != nil {
+		t.Fatal(err)
+	}
+	r.args = []string{"-c", "exec sleep 10"}
+	r.release = "1.2.0"
+	// output to a buffer is copied from pipes
+	var out bytes.Buffer
+	if err := r.cmd.Start(&out, &out); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.cmd.Terminate(false)
+		_, _ = r.cmd.Wait()
+	}()
+	path, files, err := r.writeHandover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("%d files inherited, expected shared stdout and stderr pipe", len(files))
+	}
+	for name, expected := range map[string]os.FileMode{path: 0600, filepath.Dir(path): 0700} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := fi.Mode().Perm(); mode != expected {
+			t.Fatalf("%s mode %o, expected %o", name, mode, expected)
+		}
+	}
+
+	if err := os.Setenv(handoverEnv, path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Unsetenv(handoverEnv) }()
+	s, err := readHandover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PID != r.cmd.Pid() || s.Path != "/bin/sh" || len(s.Args) != 2 || s.Release != "1.2.0" ||
+		!s.Started.Equal(r.cmd.Started()) || s.Stdout != firstInheritedFd || s.Stderr != firstInheritedFd || s.Files != 1 {
+		t.Fatalf("unexpected handover state %+v", s)
+	}
+	// state is read once and isn't seen by child
+	if os.Getenv(handoverEnv) != "" {
+		t.Fatal("handover state is passed to child")
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Fatalf("handover state is not removed: %v", err)
+	}
+	if s, err := readHandover(); s != nil || err != nil {
+		t.Fatalf("handover %+v, %v", s, err)
+	}
+}
+
+func TestAdoptChild(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("handover is supported on Linux only")
+	}
+	cmd := exec.Command("sh", "-c", "sleep 0.3; exit 3")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// adopted child exits by itself, so it's zombie is reaped by it's parent afterwards
+	defer func() { _ = cmd.Wait() }()
+	r := newTestReloader()
+	events := r.Events()
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// child writing to files directly doesn't inherit pipes
+	ch, stopChild, err := r.adoptChild(context.Background(), &handoverState{
+		PID:     cmd.Process.Pid,
+		Path:    path,
+		Args:    []string{"-c", "sleep 0.3; exit 3"},
+		Release: "1.2.0",
+		Started: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopChild()
+	if r.release != "1.2.0" || r.cmd.Pid() != cmd.Process.Pid {
+		t.Fatalf("unexpected child %s, release %s", r.cmd.Describe(), r.release)
+	}
+	select {
+	case status := <-ch:
+		// exit code of adopted child is unknown
+		if !status.Unknown || status.Code != -1 || status.Failure() || status.ShellCode() != 0 {
+			t.Fatalf("unexpected exit status %+v", status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("adopted child exit is not noticed")
+	}
+	e, ok := (<-events).(ChildExited)
+	if !ok || e.Code != -1 || !e.Status.Unknown {
+		t.Fatalf("unexpected event %#v", e)
+	}
+}
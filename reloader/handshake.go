@@ -0,0 +1,408 @@
+package reloader
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/audit"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// handshakeEnv passes handshake socket path from reloader to it's updated version.
+const handshakeEnv = "RELOADER_HANDSHAKE"
+
+// handshakeSocket is a handshake socket name in handshake directory.
+const handshakeSocket = "handshake.sock"
+
+// listenHandshake creates handshake socket in private directory dir, so socket created with umask permissions
+// is accessible by current user only. Directory file mode doesn't restrict socket access on Windows.
+func listenHandshake(dir string) (*net.UnixListener, error) {
+	l, err := net.Listen("unix", filepath.Join(dir, handshakeSocket))
+	if err != nil {
+		return nil, err
+	}
+	return l.(*net.UnixListener), nil
+}
+
+const (
+	// sent by updated reloader with it's pid when it is initialized
+	handshakeReady = "ready"
+	// sent by previous reloader when it's child is stopped, so updated reloader may start
+	handshakeGo = "go"
+	// sent by updated reloader when it has started or adopted child process
+	handshakeStarted = "started"
+	// sent by previous reloader when update is cancelled
+	handshakeAbort = "abort"
+)
+
+// updatedExitTimeout limits waiting for updated reloader to stop it's child after failed handoff.
+const updatedExitTimeout = 10 * time.Second
+
+// handoff runs updater and waits for updated reloader to report it is ready within self update timeout.
+// When it's ready, release is called to stop child process and updated reloader is allowed to start. Handoff
+// completes when updated reloader reports it has started or adopted child process within self update timeout.
+// Otherwise updater or updated reloader is terminated and previous reloader binary is restored. If release was
+// called already, caller must resume supervising child.
+func (r *Reloader) handoff(ctx context.Context, updater *executable.Executable, release func()) error {
+	// temporary directory is created with 0700 mode
+	dir, err := ioutil.TempDir("", "reloader")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	l, err := listenHandshake(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Close() }()
+	updater.SetEnv(handshakeEnv + "=" + filepath.Join(dir, handshakeSocket))
+	// reloader processes share reloader output, child output pipes must not outlive them
+	if err := updater.Start(os.Stdout, os.Stderr); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		status, err := updater.Wait()
+		if err == nil && !status.Success() {
+			err = fmt.Errorf("updater %s", status)
+		}
+		exited <- err
+	}()
+	// single connection is accepted, channel is closed after that or when listener is closed
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		defer close(accepted)
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	deadline := time.Now().Add(r.selfUpdateTimeout)
+	timer := time.NewTimer(r.selfUpdateTimeout)
+	defer timer.Stop()
+	var conn net.Conn
+	for conn == nil && err == nil {
+		select {
+		case c, ok := <-accepted:
+			if !ok {
+				err = errors.New("handshake socket is closed")
+			}
+			conn = c
+		case err = <-exited:
+			// updater exits after starting updated reloader
+			exited = nil
+		case <-timer.C:
+			err = fmt.Errorf("updated reloader is not started in %s", r.selfUpdateTimeout)
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	var rd *bufio.Reader
+	pid := 0
+	if err == nil {
+		defer func() { _ = conn.Close() }()
+		rd = bufio.NewReader(conn)
+		var msg string
+		if err = conn.SetReadDeadline(deadline); err == nil {
+			msg, err = rd.ReadString('\n')
+		}
+		if _, serr := fmt.Sscanf(msg, handshakeReady+" %d\n", &pid); err == nil && serr != nil {
+			err = fmt.Errorf("unexpected handshake message %q", msg)
+		}
+	}
+	if err != nil {
+		_ = l.Close()
+		if conn == nil {
+			// updated reloader may connect while update is cancelled
+			conn = <-accepted
+		}
+		if conn != nil {
+			_, _ = fmt.Fprintln(conn, handshakeAbort)
+			_ = conn.Close()
+		}
+		if exited != nil {
+			_ = updater.Terminate(false)
+			<-exited
+		}
+		r.restore()
+		return err
+	}
+	release()
+	if err = r.awaitStarted(conn, rd); err != nil {
+		r.logger.Printf("updated reloader pid %d failed: %s", pid, err.Error())
+		stopUpdated(pid, conn, rd)
+		r.restore()
+		return err
+	}
+	return nil
+}
+
+// awaitStarted allows updated reloader to start and waits until it reports child is started within
+// self update timeout.
+func (r *Reloader) awaitStarted(conn net.Conn, rd *bufio.Reader) error {
+	if _, err := fmt.Fprintln(conn, handshakeGo); err != nil {
+		return err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(r.selfUpdateTimeout)); err != nil {
+		return err
+	}
+	msg, err := rd.ReadString('\n')
+	if err == io.EOF {
+		return errors.New("updated reloader exited before starting child")
+	}
+	if err != nil {
+		return err
+	}
+	if msg = strings.TrimSpace(msg); msg != handshakeStarted {
+		return fmt.Errorf("unexpected handshake message %q", msg)
+	}
+	return nil
+}
+
+// stopUpdated interrupts updated reloader that failed to start, so it terminates it's child, and waits until
+// it closes handshake connection on exit.
+func stopUpdated(pid int, conn net.Conn, rd *bufio.Reader) {
+	if p, err := os.FindProcess(pid); err == nil && pid > 0 {
+		if err := p.Signal(os.Interrupt); err != nil {
+			_ = p.Kill()
+		}
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(updatedExitTimeout)); err != nil {
+		return
+	}
+	for {
+		if _, err := rd.ReadString('\n'); err != nil {
+			return
+		}
+	}
+}
+
+// restore restores running reloader binary after failed self update, see restoreSelf.
+func (r *Reloader) restore() {
+	if err := r.restoreSelf(); err != nil {
+		r.logger.Printf("restore %s error: %s", r.self.Path(), err.Error())
+	}
+}
+
+// restoreSelf restores running reloader binary from backup if updater has replaced it.
+func (r *Reloader) restoreSelf() error {
+	return r.restoreBinary(r.self)
+}
+
+// restoreBinary restores prev reloader binary from backup if it is replaced.
+func (r *Reloader) restoreBinary(prev *executable.Executable) error {
+	path := prev.Path()
+	cur, err := executable.NewExecutable(path)
+	if err == nil && cur.Checksum() == prev.Checksum() {
+		return nil
+	}
+	backup, err := executable.NewExecutable(path + executable.BackupSuffix)
+	if err != nil {
+		return err
+	}
+	if backup.Checksum() != prev.Checksum() {
+		return fmt.Errorf("backup %s doesn't match previous binary", backup.Path())
+	}
+	r.logger.Printf("restoring %s from %s", path, backup.Path())
+	if err := os.Rename(backup.Path(), path); err != nil {
+		return err
+	}
+	if cur != nil {
+		r.logAudit(audit.Rollback, cur, prev.Checksum(), prev.Version(), backup.Path())
+	}
+	return nil
+}
+
+// daemonHandshakeDir returns handshake directory for reloader binary restarted by service manager. Directory is
+// kept next to binary, as updater and restarted daemon may not share temporary directory.
+func daemonHandshakeDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".handshake")
+}
+
+// UpdateDaemon replaces reloader binary what with current executable and restarts service name with it.
+// If restarted reloader doesn't report it has started child within self update timeout, previous binary is
+// restored and service is restarted again.
+func (r *Reloader) UpdateDaemon(what, name string) error {
+	prev, err := executable.NewExecutable(what)
+	if err != nil {
+		return err
+	}
+	if err := prev.ProbeVersion(r.versionArg); err != nil {
+		r.logger.Printf("version probe: %s", err.Error())
+	}
+	r.openAudit()
+	r.actor = actorCommand
+	dir := daemonHandshakeDir(what)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	l, err := listenHandshake(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Close() }()
+	updater, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	next, err := executable.NewExecutable(updater)
+	if err != nil {
+		return err
+	}
+	if err := r.Update(what, false); err != nil {
+		return err
+	}
+	err = r.RestartDaemon(name)
+	if err == nil {
+		err = r.awaitDaemon(l)
+	}
+	if err == nil {
+		r.logger.Printf("daemon %s started", name)
+		return nil
+	}
+	r.logger.Printf("updated daemon %s failed: %s", name, err.Error())
+	// restarted daemon doesn't retry failed binary if it keeps state
+	if serr := r.openState(); serr != nil {
+		r.logger.Printf("state open error: %s", serr.Error())
+	}
+	r.recordFailure(prev, next.Checksum(), source.Candidate{Checksum: next.Checksum()},
+		fmt.Sprintf("self update failed: %s", err.Error()))
+	if rerr := r.restoreBinary(prev); rerr != nil {
+		return fmt.Errorf("%w, restore %s: %s", err, what, rerr.Error())
+	}
+	if rerr := r.RestartDaemon(name); rerr != nil {
+		return fmt.Errorf("%w, restart with previous binary: %s", err, rerr.Error())
+	}
+	return err
+}
+
+// awaitDaemon waits for restarted reloader to connect to handshake socket and report child is started,
+// each within self update timeout.
+func (r *Reloader) awaitDaemon(l *net.UnixListener) error {
+	if err := l.SetDeadline(time.Now().Add(r.selfUpdateTimeout)); err != nil {
+		return err
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		return fmt.Errorf("updated reloader is not started in %s: %w", r.selfUpdateTimeout, err)
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetReadDeadline(time.Now().Add(r.selfUpdateTimeout)); err != nil {
+		return err
+	}
+	rd := bufio.NewReader(conn)
+	msg, err := rd.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(msg, handshakeReady+" ") {
+		return fmt.Errorf("unexpected handshake message %q", msg)
+	}
+	// previous reloader is stopped by service manager already
+	return r.awaitStarted(conn, rd)
+}
+
+// confirmHandoff reports to previous reloader that updated reloader is initialized and waits until previous
+// reloader stops it's child. Handshake connection is kept until completeHandoff, so previous reloader resumes if
+// updated reloader exits before starting child. Daemon reports to updater waiting for it after service restart.
+// It does nothing if reloader is not started by self update.
+func (r *Reloader) confirmHandoff() error {
+	sock := os.Getenv(handshakeEnv)
+	if sock == "" && r.daemon {
+		sock = filepath.Join(daemonHandshakeDir(r.self.Path()), handshakeSocket)
+		if _, err := os.Stat(sock); err != nil {
+			return nil
+		}
+		conn, err := net.DialTimeout("unix", sock, 5*time.Second)
+		if err != nil {
+			// stale socket left by terminated updater
+			r.logger.Printf("self update handshake: %s", err.Error())
+			return nil
+		}
+		return r.startHandoff(conn)
+	}
+	if sock == "" {
+		return nil
+	}
+	// child process must not see handshake socket
+	if err := os.Unsetenv(handshakeEnv); err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("unix", sock, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	return r.startHandoff(conn)
+}
+
+// startHandoff reports updated reloader is ready over handshake connection and waits for previous reloader reply.
+func (r *Reloader) startHandoff(conn net.Conn) error {
+	if _, err := fmt.Fprintf(conn, "%s %d\n", handshakeReady, os.Getpid()); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	// previous reloader closes connection if it exits without reply
+	msg, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	if msg = strings.TrimSpace(msg); msg != handshakeGo {
+		_ = conn.Close()
+		return fmt.Errorf("previous reloader replied %q", msg)
+	}
+	r.logger.Print("previous reloader handed over")
+	r.handshake = conn
+	return nil
+}
+
+// completeHandoff reports to previous reloader that child is started and closes handshake connection.
+func (r *Reloader) completeHandoff() {
+	if r.handshake == nil {
+		return
+	}
+	// previous reloader is gone if reply fails, so updated reloader keeps running anyway
+	if _, err := fmt.Fprintln(r.handshake, handshakeStarted); err != nil {
+		r.logger.Printf("handshake reply error: %s", err.Error())
+	}
+	r.closeHandoff()
+}
+
+// closeHandoff closes handshake connection, previous reloader resumes if child is not reported to be started.
+func (r *Reloader) closeHandoff() {
+	if r.handshake != nil {
+		_ = r.handshake.Close()
+		r.handshake = nil
+	}
+}
+
+// restartArgs returns reloader command line args without --update flag passed to updater.
+// Only first flag occurrence is removed, as following ones belong to child args.
+func restartArgs(args []string) []string {
+	for i, arg := range args {
+		flag := strings.TrimLeft(arg, "-")
+		if flag == arg {
+			continue
+		}
+		if flag == "update" && i+1 < len(args) {
+			return append(append([]string{}, args[:i]...), args[i+2:]...)
+		}
+		if strings.HasPrefix(flag, "update=") {
+			return append(append([]string{}, args[:i]...), args[i+1:]...)
+		}
+	}
+	return args
+}
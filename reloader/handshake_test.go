@@ -0,0 +1,175 @@
+package reloader
+
+import (
+	"context"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newHandoffReloader returns reloader running test binary as itself.
+func newHandoffReloader(t *testing.T) *Reloader {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets")
+	}
+	r := newTestReloader()
+	r.selfUpdateTimeout = 10 * time.Second
+	var err error
+	if r.self, err = executable.NewExecutable(os.Args[0]); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestHandoff(t *testing.T) {
+	testCases := []struct {
+		name string
+		// updater is test binary acting as updated reloader, see TestMain
+		env      []string
+		err      string
+		released bool
+	}{
+		{"started", nil, "", true},
+		{"updated reloader failed", []string{failEnv + "=1"}, "updated reloader exited before starting child", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newHandoffReloader(t)
+			updater, err := executable.NewExecutable(os.Args[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			updater.SetEnv(tc.env...)
+			released := false
+			err = r.handoff(context.Background(), updater, func() { released = true })
+			if released != tc.released {
+				t.Fatalf("released %v, expected %v", released, tc.released)
+			}
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("error %v, expected %s", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestHandoffUpdaterFailed(t *testing.T) {
+	r := newHandoffReloader(t)
+	dir, err := ioutil.TempDir("", "updater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "updater")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\nexit 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	updater, err := executable.NewExecutable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	released := false
+	err = r.handoff(context.Background(), updater, func() { released = true })
+	if err == nil || !strings.Contains(err.Error(), "updater exit code 3") {
+		t.Fatalf("error %v, expected updater exit status", err)
+	}
+	// child keeps running when updater fails
+	if released {
+		t.Fatal("child is released")
+	}
+}
+
+func TestListenHandshake(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file mode doesn't restrict socket access")
+	}
+	dir, err := ioutil.TempDir("", "reloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0700 {
+		t.Fatalf("handshake directory mode %o", mode)
+	}
+	l, err := listenHandshake(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	conn, err := net.Dial("unix", filepath.Join(dir, handshakeSocket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+func TestConfirmHandoff(t *testing.T) {
+	r := newHandoffReloader(t)
+	// reloader not started by self update doesn't handshake
+	if err := r.confirmHandoff(); err != nil || r.handshake != nil {
+		t.Fatalf("handshake %v, %v", r.handshake, err)
+	}
+	dir, err := ioutil.TempDir("", "reloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	l, err := listenHandshake(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		buf := make([]byte, 64)
+		_, _ = conn.Read(buf)
+		_, _ = conn.Write([]byte(handshakeAbort + "\n"))
+	}()
+	if err := os.Setenv(handshakeEnv, filepath.Join(dir, handshakeSocket)); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Unsetenv(handshakeEnv) }()
+	// updated reloader exits when update is cancelled
+	if err := r.confirmHandoff(); err == nil || !strings.Contains(err.Error(), handshakeAbort) {
+		t.Fatalf("error %v, expected abort", err)
+	}
+	// child process doesn't see handshake socket
+	if os.Getenv(handshakeEnv) != "" {
+		t.Fatal("handshake socket is passed to child")
+	}
+}
+
+func TestRestartArgs(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"--update", "/bin/reloader", "app"}, []string{"app"}},
+		{[]string{"-v", "--update=/bin/reloader", "app"}, []string{"-v", "app"}},
+		{[]string{"--update", "/bin/reloader", "app", "--update", "x"}, []string{"app", "--update", "x"}},
+	}
+	for _, tc := range testCases {
+		if args := restartArgs(tc.args); strings.Join(args, " ") != strings.Join(tc.expected, " ") {
+			t.Errorf("restartArgs(%v) = %v, expected %v", tc.args, args, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package reloader
+
+import (
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/audit"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"github.com/tumb1er/go-reloader/reloader/state"
+	"github.com/tumb1er/go-reloader/reloader/version"
+	"path/filepath"
+	"time"
+)
+
+// openState opens state store and restores bad builds list. State is not kept if state directory is not set.
+func (r *Reloader) openState() error {
+	if r.stateDir == "" {
+		return nil
+	}
+	s, err := state.Open(r.stateDir)
+	if err != nil {
+		return err
+	}
+	r.store = s
+	st := s.State()
+	r.restoreFailures(st)
+	if e, ok := st.Applied[filepath.Base(r.child)]; ok {
+		r.logger.Printf("last update: %s %s %s at %s", e.Action, e.Name, e.Version, e.Time.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// restoreFailures restores bad builds list from state.
+func (r *Reloader) restoreFailures(st state.State) {
+	if len(st.Failures) > 0 && r.invalid == nil {
+		r.invalid = make(map[string]string)
+	}
+	for key, f := range st.Failures {
+		r.invalid[key] = f.Reason
+	}
+}
+
+// updateState modifies and saves reloader state. Errors are only logged as state is not required to run.
+func (r *Reloader) updateState(f func(st *state.State)) {
+	if r.store == nil {
+		return
+	}
+	if err := r.store.Update(f); err != nil {
+		r.logger.Printf("state save error: %s", err.Error())
+	}
+}
+
+// recordUpdate adds update history entry for executable cmd replaced with binary with checksum to.
+func (r *Reloader) recordUpdate(action string, cmd *executable.Executable, to, version string) {
+	r.updateState(func(st *state.State) {
+		st.Record(state.Entry{
+			Time:    time.Now(),
+			Name:    cmd.String(),
+			Action:  action,
+			From:    cmd.Checksum(),
+			To:      to,
+			Version: version,
+			Release: r.currentRelease(),
+		})
+	})
+}
+
+// openAudit opens audit log if it is configured.
+func (r *Reloader) openAudit() {
+	if r.auditFile != "" {
+		r.auditLog = audit.New(r.auditFile)
+		r.auditLog.SetKey(r.auditKey)
+	}
+}
+
+// recordFailure remembers a bad build with key across restarts.
+func (r *Reloader) recordFailure(cmd *executable.Executable, key string, c source.Candidate, reason string) {
+	r.updateState(func(st *state.State) {
+		st.Fail(key, state.Failure{
+			Time:     time.Now(),
+			Name:     cmd.String(),
+			Checksum: c.Checksum,
+			Version:  c.Version,
+			Reason:   reason,
+		})
+	})
+}
+
+// Actors initiating updates and restarts, recorded in audit log.
+const (
+	actorTicker  = "ticker"
+	actorControl = "control"
+	actorSignal  = "signal"
+	// update applied after child exited by itself
+	actorExit = "exit"
+	// apply or rollback command run while reloader is not running
+	actorCommand = "command"
+)
+
+// recordAudit appends audit log entry for executable from replaced with binary with checksum to.
+func (r *Reloader) recordAudit(action string, from *executable.Executable, to, version, location string) error {
+	if r.auditLog == nil {
+		return nil
+	}
+	if err := r.auditLog.Append(audit.Entry{
+		Time:         time.Now(),
+		Action:       action,
+		Name:         from.String(),
+		FromChecksum: from.Checksum(),
+		ToChecksum:   to,
+		FromVersion:  from.Version(),
+		ToVersion:    version,
+		Source:       location,
+		Actor:        r.actor,
+	}); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	return nil
+}
+
+// logAudit records audit log entry for an action that has happened already, errors are only logged.
+func (r *Reloader) logAudit(action string, from *executable.Executable, to, version, location string) {
+	if err := r.recordAudit(action, from, to, version, location); err != nil {
+		r.logger.Print(err.Error())
+	}
+}
+
+// checkAudit reports an error if audit log is configured and entries can't be appended to it, so updates are
+// refused before child process is stopped.
+func (r *Reloader) checkAudit() error {
+	if r.auditLog == nil {
+		return nil
+	}
+	if err := r.auditLog.Check(); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	return nil
+}
+
+// auditReplace appends audit log entry for executable cmd about to be replaced with binary at path from update
+// candidate c. Entry is appended before binary is replaced, so replacement is refused if it can't be recorded.
+func (r *Reloader) auditReplace(action string, cmd *executable.Executable, path string, c source.Candidate) error {
+	if r.auditLog == nil {
+		return nil
+	}
+	next, err := executable.NewExecutable(path)
+	if err != nil {
+		return err
+	}
+	// version reported by update source is kept for binaries not embedding it
+	v := c.Version
+	if v == "" {
+		v = next.Version()
+	}
+	if action == audit.Switch {
+		action = switchAction(cmd.Version(), v)
+	}
+	return r.recordAudit(action, cmd, next.Checksum(), v, c.Location)
+}
+
+// switchAction returns audited action for replacing binary of version from with version to.
+func switchAction(from, to string) string {
+	if from != "" && to != "" && version.Compare(to, from) < 0 {
+		return audit.Rollback
+	}
+	return audit.Switch
+}
@@ -0,0 +1,152 @@
+package reloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// HookEvent is a name of reloader lifecycle event.
+type HookEvent string
+
+const (
+	// OnUpdateDetected fires when a new binary is found in staging directory.
+	OnUpdateDetected HookEvent = "update-detected"
+	// OnBeforeSwitch fires before child binary is replaced, failing hook vetoes the update.
+	OnBeforeSwitch HookEvent = "before-switch"
+	// OnAfterSwitch fires after child binary is replaced.
+	OnAfterSwitch HookEvent = "after-switch"
+	// OnChildStarted fires after child process start.
+	OnChildStarted HookEvent = "child-started"
+	// OnChildExited fires after child process exit.
+	OnChildExited HookEvent = "child-exited"
+	// OnRollback fires when a previous binary is restored.
+	OnRollback HookEvent = "rollback"
+	// OnSelfUpdate fires before reloader starts updating itself.
+	OnSelfUpdate HookEvent = "self-update"
+)
+
+// HookEvents lists all supported lifecycle events.
+var HookEvents = []HookEvent{
+	OnUpdateDetected, OnBeforeSwitch, OnAfterSwitch, OnChildStarted, OnChildExited, OnRollback, OnSelfUpdate,
+}
+
+// DefaultHookTimeout limits hook execution if hook timeout is not set, so a hung hook doesn't stall reloader.
+const DefaultHookTimeout = 30 * time.Second
+
+// hookTimeout returns hook execution time limit, DefaultHookTimeout if timeout is not set.
+func hookTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultHookTimeout
+	}
+	return timeout
+}
+
+// Hook is a handler called on reloader lifecycle events.
+type Hook interface {
+	// Fire handles an event with event details in data.
+	Fire(ctx context.Context, event HookEvent, data map[string]string) error
+}
+
+// CommandHook runs a command passing event details in RELOADER_* environment variables.
+type CommandHook struct {
+	Command string
+	Args    []string
+	// command is killed after timeout, DefaultHookTimeout if not set
+	Timeout time.Duration
+}
+
+// Fire runs hook command and waits for it's completion.
+func (h CommandHook) Fire(ctx context.Context, event HookEvent, data map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout(h.Timeout))
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Env = append(os.Environ(), "RELOADER_EVENT="+string(event))
+	for k, v := range data {
+		cmd.Env = append(cmd.Env, "RELOADER_"+strings.ToUpper(k)+"="+v)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return fmt.Errorf("%s: %s: %s", h.Command, err.Error(), out)
+		}
+		return fmt.Errorf("%s: %s", h.Command, err.Error())
+	}
+	return nil
+}
+
+// WebHook sends event details as JSON in HTTP POST request.
+type WebHook struct {
+	URL string
+	// request is cancelled after timeout, DefaultHookTimeout if not set
+	Timeout time.Duration
+}
+
+// Fire posts event payload to hook URL and checks response status.
+func (h WebHook) Fire(ctx context.Context, event HookEvent, data map[string]string) error {
+	payload, err := json.Marshal(struct {
+		Event HookEvent         `json:"event"`
+		Time  time.Time         `json:"time"`
+		Data  map[string]string `json:"data"`
+	}{event, time.Now(), data})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout(h.Timeout))
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", h.URL, resp.Status)
+	}
+	return nil
+}
+
+// ParseHookEvent checks that event name is a known lifecycle event.
+func ParseHookEvent(name string) (HookEvent, error) {
+	for _, e := range HookEvents {
+		if string(e) == name {
+			return e, nil
+		}
+	}
+	return "", fmt.Errorf("unknown hook event: %s", name)
+}
+
+// fireHooksBackground calls hooks registered for an event without waiting for them, hook errors are only logged.
+func (r *Reloader) fireHooksBackground(event HookEvent, data map[string]string) {
+	if len(r.hooks[event]) == 0 {
+		return
+	}
+	r.backgroundHooks.Add(1)
+	go func() {
+		defer r.backgroundHooks.Done()
+		_ = r.fireHooks(event, data)
+	}()
+}
+
+// fireHooks calls all hooks registered for an event and returns first hook error.
+func (r *Reloader) fireHooks(event HookEvent, data map[string]string) error {
+	var result error
+	for _, h := range r.hooks[event] {
+		if err := h.Fire(context.Background(), event, data); err != nil {
+			r.logger.Printf("%s hook failed: %s", event, err.Error())
+			if result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,249 @@
+package reloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookFunc is a hook calling a function.
+type hookFunc func(event HookEvent, data map[string]string) error
+
+// Fire calls f.
+func (f hookFunc) Fire(_ context.Context, event HookEvent, data map[string]string) error {
+	return f(event, data)
+}
+
+// newTestReloader returns reloader not writing logs.
+func newTestReloader() *Reloader {
+	r := NewReloader("test")
+	r.SetLogger(log.New(ioutil.Discard, "", 0))
+	return r
+}
+
+func TestHookTimeout(t *testing.T) {
+	testCases := []struct {
+		timeout  time.Duration
+		expected time.Duration
+	}{
+		{0, DefaultHookTimeout},
+		{-time.Second, DefaultHookTimeout},
+		{time.Second, time.Second},
+	}
+	for _, tc := range testCases {
+		if timeout := hookTimeout(tc.timeout); timeout != tc.expected {
+			t.Errorf("hookTimeout(%s) = %s, expected %s", tc.timeout, timeout, tc.expected)
+		}
+	}
+}
+
+func TestCommandHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands are shell scripts")
+	}
+	dir, err := ioutil.TempDir("", "hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	out := filepath.Join(dir, "out")
+	testCases := []struct {
+		name     string
+		hook     CommandHook
+		err      string
+		expected string
+	}{
+		{"environment", CommandHook{Command: "sh", Args: []string{"-c",
+			`echo "$RELOADER_EVENT $RELOADER_NAME $RELOADER_NEW_VERSION" > ` + out}},
+			"", "before-switch app 1.2.0\n"},
+		{"veto", CommandHook{Command: "sh", Args: []string{"-c", "echo not now; exit 1"}},
+			"sh: exit status 1: not now", ""},
+		{"timeout", CommandHook{Command: "sleep", Args: []string{"10"}, Timeout: 100 * time.Millisecond},
+			"sleep: signal: killed", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = os.Remove(out)
+			start := time.Now()
+			err := tc.hook.Fire(context.Background(), OnBeforeSwitch, map[string]string{
+				"name":        "app",
+				"new_version": "1.2.0",
+			})
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("hook is not killed on timeout")
+			}
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("error %v, expected %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err := ioutil.ReadFile(out); err != nil || string(data) != tc.expected {
+				t.Fatalf("hook output %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestWebHook(t *testing.T) {
+	var payload struct {
+		Event HookEvent         `json:"event"`
+		Data  map[string]string `json:"data"`
+	}
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		case "/slow":
+			<-done
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+	testCases := []struct {
+		name string
+		hook WebHook
+		err  bool
+	}{
+		{"ok", WebHook{URL: server.URL + "/ok"}, false},
+		{"veto", WebHook{URL: server.URL + "/veto"}, true},
+		{"timeout", WebHook{URL: server.URL + "/slow", Timeout: 100 * time.Millisecond}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			err := tc.hook.Fire(context.Background(), OnChildExited, map[string]string{"exit_code": "2"})
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("request is not cancelled on timeout")
+			}
+			if tc.err != (err != nil) {
+				t.Fatalf("error %v", err)
+			}
+		})
+	}
+	if payload.Event != OnChildExited || payload.Data["exit_code"] != "2" {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+}
+
+func TestParseHookEvent(t *testing.T) {
+	for _, e := range HookEvents {
+		if parsed, err := ParseHookEvent(string(e)); err != nil || parsed != e {
+			t.Errorf("ParseHookEvent(%s) = %s, %v", e, parsed, err)
+		}
+	}
+	if _, err := ParseHookEvent("before-start"); err == nil {
+		t.Error("expected error for unknown event")
+	}
+}
+
+func TestFireHooks(t *testing.T) {
+	r := newTestReloader()
+	var fired []string
+	veto := errors.New("veto")
+	r.AddHook(OnBeforeSwitch, hookFunc(func(HookEvent, map[string]string) error {
+		fired = append(fired, "first")
+		return veto
+	}))
+	r.AddHook(OnBeforeSwitch, hookFunc(func(HookEvent, map[string]string) error {
+		fired = append(fired, "second")
+		return errors.New("second veto")
+	}))
+	// all hooks are fired and first error is returned
+	if err := r.fireHooks(OnBeforeSwitch, nil); err != veto {
+		t.Fatalf("error %v", err)
+	}
+	if strings.Join(fired, ",") != "first,second" {
+		t.Fatalf("fired %v", fired)
+	}
+	if err := r.fireHooks(OnAfterSwitch, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFireHooksBackground(t *testing.T) {
+	r := newTestReloader()
+	var mu sync.Mutex
+	fired := 0
+	release := make(chan struct{})
+	r.AddHook(OnChildExited, hookFunc(func(HookEvent, map[string]string) error {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		fired++
+		return nil
+	}))
+	// slow hook doesn't block caller
+	r.fireHooksBackground(OnChildExited, nil)
+	r.fireHooksBackground(OnChildStarted, nil)
+	close(release)
+	r.backgroundHooks.Wait()
+	if fired != 1 {
+		t.Fatalf("hook fired %d times", fired)
+	}
+}
+
+func TestApprove(t *testing.T) {
+	r := newTestReloader()
+	cmd, err := executable.NewExecutable(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	vetoed := map[string]bool{"1.3.0": true}
+	fired := 0
+	r.AddHook(OnBeforeSwitch, hookFunc(func(_ HookEvent, data map[string]string) error {
+		fired++
+		if vetoed[data["new_version"]] {
+			return errors.New("vetoed")
+		}
+		return nil
+	}))
+	c1 := source.Candidate{Location: "app", Checksum: "c1", Version: "1.2.0"}
+	c2 := source.Candidate{Location: "app", Checksum: "c2", Version: "1.3.0"}
+	testCases := []struct {
+		name     string
+		c        source.Candidate
+		approved bool
+		fired    int
+	}{
+		{"first approval", c1, true, 1},
+		{"approved update", c1, true, 1},
+		{"other update", c2, false, 2},
+		{"update approved again after veto", c1, true, 3},
+		{"vetoed update", c2, false, 4},
+		{"vetoed update again", c2, false, 5},
+	}
+	for _, tc := range testCases {
+		if approved := r.approve(cmd, tc.c); approved != tc.approved {
+			t.Fatalf("%s: approved %v", tc.name, approved)
+		}
+		if fired != tc.fired {
+			t.Fatalf("%s: hooks fired %d times, expected %d", tc.name, fired, tc.fired)
+		}
+	}
+}
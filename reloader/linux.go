@@ -3,6 +3,7 @@
 package reloader
 
 import (
+	"errors"
 	"github.com/sevlyar/go-daemon"
 	"os"
 	"os/exec"
@@ -10,6 +11,10 @@ import (
 
 // Daemonize detaches console application from terminal, making reloader a daemon.
 func (r *Reloader) Daemonize() error {
+	if r.handover {
+		return errors.New("child handover is not supported in daemon mode")
+	}
+	r.daemon = true
 	ctx := daemon.Context{}
 	d, err := ctx.Reborn()
 	if err != nil {
@@ -27,17 +32,17 @@ func (r *Reloader) Daemonize() error {
 	return r.Run()
 }
 
-func (r Reloader) RestartDaemon(name string) error {
+func (r *Reloader) RestartDaemon(name string) error {
 	r.logger.Printf("Restaring daemon %s", name)
 	cmd := exec.Command("service", name, "restart")
 	cmd.Stdout = r.stdout
 	cmd.Stderr = r.stderr
 	if err := cmd.Start(); err != nil {
-		r.logger.Fatalf("service restart error: %s", err.Error())
+		r.logger.Printf("service restart error: %s", err.Error())
 		return err
 	}
 	if err := cmd.Wait(); err != nil {
-		r.logger.Fatalf("service restart failed: %s", err.Error())
+		r.logger.Printf("service restart failed: %s", err.Error())
 		return err
 	}
 	return nil
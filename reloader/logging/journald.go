@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Journal is a writer sending each line to systemd-journald using native protocol.
+type Journal struct {
+	fields
+	lines
+	tag      string
+	priority Priority
+	mu       sync.Mutex
+	conn     *net.UnixConn
+}
+
+// Write sends every complete line of p as separate journal entry, incomplete line is buffered. Lines failed to send
+// are dropped as syslog(3) does and p is always consumed, so copying child output is not stopped by sink failures.
+func (j *Journal) Write(p []byte) (int, error) {
+	for _, line := range j.lines.split(p) {
+		_ = j.send(line, nil)
+	}
+	return len(p), nil
+}
+
+// WriteFields sends p as a single journal entry with additional fields.
+func (j *Journal) WriteFields(p []byte, fields map[string]string) (int, error) {
+	if err := j.send(bytes.TrimRight(p, "\n"), fields); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close flushes incomplete line and closes journal socket.
+func (j *Journal) Close() error {
+	if line := j.lines.flush(); len(line) > 0 {
+		if err := j.send(line, nil); err != nil {
+			return err
+		}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.conn.Close()
+}
+
+// send serializes journal entry and writes it as a single datagram, entries exceeding datagram size limit are
+// passed in a memory file.
+func (j *Journal) send(msg []byte, extra map[string]string) error {
+	var b bytes.Buffer
+	appendField(&b, "MESSAGE", string(msg))
+	appendField(&b, "PRIORITY", strconv.Itoa(int(j.priority)))
+	appendField(&b, "SYSLOG_IDENTIFIER", j.tag)
+	names, values := j.fields.merge(extra)
+	for _, name := range names {
+		appendField(&b, fieldName(name), values[name])
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.conn.Write(b.Bytes()); err != nil {
+		return sendLarge(j.conn, b.Bytes(), err)
+	}
+	return nil
+}
+
+// appendField serializes a field, using binary form for multiline values.
+func appendField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.ContainsRune(value, '\n') {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// fieldName converts a name to journal field name format (uppercase letters, digits and underscores).
+func fieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, name)
+}
+
+// NewJournal connects to journald native protocol socket.
+func NewJournal(socket, tag string, priority Priority) (*Journal, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{
+		tag:      tag,
+		priority: priority,
+		conn:     conn,
+	}, nil
+}
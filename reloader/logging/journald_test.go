@@ -0,0 +1,105 @@
+// +build linux
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// readEntry reads journal entry sent as a datagram or in a memory file and parses it's fields.
+func readEntry(t *testing.T, l *net.UnixConn) map[string]string {
+	if err := l.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf, oob := make([]byte, 64*1024), make([]byte, 1024)
+	n, oobn, _, _, err := l.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+	if oobn > 0 {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "journal-entry")
+		defer func() { _ = f.Close() }()
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// memory file offset is shared with sender
+		data = make([]byte, fi.Size())
+		if _, err := f.ReadAt(data, 0); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+	}
+	result := make(map[string]string)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if j := bytes.IndexByte(data[:i], '='); j >= 0 {
+			result[string(data[:j])] = string(data[j+1 : i])
+			data = data[i+1:]
+			continue
+		}
+		name := string(data[:i])
+		size := binary.LittleEndian.Uint64(data[i+1:])
+		result[name] = string(data[i+9 : i+9+int(size)])
+		data = data[i+9+int(size)+1:]
+	}
+	return result
+}
+
+func TestJournal(t *testing.T) {
+	l, path, cleanup := listenUnixgram(t)
+	defer cleanup()
+	w, err := Open("journald:"+path, "app", Err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := w.(*Journal)
+	j.SetField("child.pid", "42")
+	if n, err := j.Write([]byte("first\npartial")); err != nil || n != 13 {
+		t.Fatalf("write %d, %v", n, err)
+	}
+	if _, err := j.WriteFields([]byte("multi\nline\n"), map[string]string{"UPDATE_EVENT": "switch"}); err != nil {
+		t.Fatal(err)
+	}
+	large := strings.Repeat("x", 1024*1024)
+	if _, err := j.Write([]byte(large + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []map[string]string{
+		{"MESSAGE": "first", "PRIORITY": "3", "SYSLOG_IDENTIFIER": "app", "CHILD_PID": "42"},
+		{"MESSAGE": "multi\nline", "PRIORITY": "3", "SYSLOG_IDENTIFIER": "app", "CHILD_PID": "42",
+			"UPDATE_EVENT": "switch"},
+		// entry exceeding datagram size limit is passed in memory file
+		{"MESSAGE": "partial" + large, "PRIORITY": "3", "SYSLOG_IDENTIFIER": "app", "CHILD_PID": "42"},
+	}
+	for _, expected := range testCases {
+		entry := readEntry(t, l)
+		for name, value := range expected {
+			if entry[name] != value {
+				t.Fatalf("%s is %.40q, expected %.40q", name, entry[name], value)
+			}
+		}
+		if len(entry) != len(expected) {
+			t.Fatalf("unexpected fields: %q", entry)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Priority is a syslog severity level of a message.
+type Priority int
+
+const (
+	Emerg Priority = iota
+	Alert
+	Crit
+	Err
+	Warning
+	Notice
+	Info
+	Debug
+)
+
+const (
+	// default syslog unix socket path
+	syslogSocket = "/dev/log"
+	// default journald native protocol socket path
+	journalSocket = "/run/systemd/journal/socket"
+)
+
+// Fielder is implemented by log sinks supporting structured message fields.
+type Fielder interface {
+	// SetField attaches a field to all subsequent messages, empty value removes it.
+	SetField(name, value string)
+	// WriteFields writes a message with additional per-message fields.
+	WriteFields(p []byte, fields map[string]string) (int, error)
+}
+
+// IsSink checks whether log destination is a syslog or journald sink and not a file path.
+func IsSink(spec string) bool {
+	for _, prefix := range []string{"syslog", "journald"} {
+		if spec == prefix || strings.HasPrefix(spec, prefix+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Open connects to a log sink described by spec:
+//   - "syslog" or "syslog:/dev/log" - RFC 5424 syslog over a unix datagram socket
+//   - "syslog://host:514" - RFC 5424 syslog over UDP
+//   - "journald" or "journald:/run/systemd/journal/socket" - journald native protocol
+func Open(spec, tag string, priority Priority) (io.WriteCloser, error) {
+	switch {
+	case spec == "syslog":
+		return NewSyslog("unixgram", syslogSocket, tag, priority)
+	case strings.HasPrefix(spec, "syslog://"):
+		return NewSyslog("udp", strings.TrimPrefix(spec, "syslog://"), tag, priority)
+	case strings.HasPrefix(spec, "syslog:"):
+		return NewSyslog("unixgram", strings.TrimPrefix(spec, "syslog:"), tag, priority)
+	case spec == "journald":
+		return NewJournal(journalSocket, tag, priority)
+	case strings.HasPrefix(spec, "journald:"):
+		return NewJournal(strings.TrimPrefix(spec, "journald:"), tag, priority)
+	}
+	return nil, errors.New("unknown log sink: " + spec)
+}
+
+// fields keeps persistent structured fields of a sink.
+type fields struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// SetField attaches a field to all subsequent messages, empty value removes it.
+func (f *fields) SetField(name, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if value == "" {
+		delete(f.values, name)
+		return
+	}
+	if f.values == nil {
+		f.values = make(map[string]string)
+	}
+	f.values[name] = value
+}
+
+// merge returns persistent fields combined with per-message ones, sorted by name.
+func (f *fields) merge(extra map[string]string) ([]string, map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := make(map[string]string, len(f.values)+len(extra))
+	for k, v := range f.values {
+		result[k] = v
+	}
+	for k, v := range extra {
+		result[k] = v
+	}
+	names := make([]string, 0, len(result))
+	for k := range result {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names, result
+}
+
+// lines splits written data to separate messages, keeping incomplete last line buffered.
+type lines struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+// split appends p to buffer and returns all complete lines.
+func (l *lines) split(p []byte) [][]byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	var result [][]byte
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := make([]byte, i)
+		copy(line, l.buf[:i])
+		result = append(result, line)
+		l.buf = l.buf[i+1:]
+	}
+	return result
+}
+
+// flush returns buffered incomplete line if any.
+func (l *lines) flush() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	line := l.buf
+	l.buf = nil
+	return line
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// listenUnixgram creates fake log daemon socket, cleanup closes it.
+func listenUnixgram(t *testing.T) (*net.UnixConn, string, func()) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "log.sock")
+	l, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return l, path, func() {
+		_ = l.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestIsSink(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		expected bool
+	}{
+		{"syslog", true},
+		{"syslog:/dev/log", true},
+		{"syslog://localhost:514", true},
+		{"journald", true},
+		{"journald:/run/systemd/journal/socket", true},
+		{"syslog.log", false},
+		{"/var/log/journald", false},
+		{"", false},
+	}
+	for _, tc := range testCases {
+		if sink := IsSink(tc.spec); sink != tc.expected {
+			t.Errorf("IsSink(%q) = %v, expected %v", tc.spec, sink, tc.expected)
+		}
+	}
+}
+
+func TestOpenUnknown(t *testing.T) {
+	if _, err := Open("kafka://localhost", "app", Info); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLines(t *testing.T) {
+	var l lines
+	testCases := []struct {
+		write    string
+		expected []string
+	}{
+		{"first", nil},
+		{" line\nsecond line\nthi", []string{"first line", "second line"}},
+		{"rd\n\n", []string{"third", ""}},
+	}
+	for _, tc := range testCases {
+		var result []string
+		for _, line := range l.split([]byte(tc.write)) {
+			result = append(result, string(line))
+		}
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Fatalf("split(%q) = %q, expected %q", tc.write, result, tc.expected)
+		}
+	}
+	l.split([]byte("last"))
+	if line := l.flush(); string(line) != "last" {
+		t.Fatalf("flushed %q", line)
+	}
+	if line := l.flush(); line != nil {
+		t.Fatalf("flushed %q twice", line)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var f fields
+	f.SetField("CHILD_PID", "42")
+	f.SetField("CHILD_VERSION", "1.0.0")
+	f.SetField("CHILD_VERSION", "")
+	names, values := f.merge(map[string]string{"UPDATE_EVENT": "switch", "CHILD_PID": "43"})
+	if !reflect.DeepEqual(names, []string{"CHILD_PID", "UPDATE_EVENT"}) {
+		t.Fatalf("names %q", names)
+	}
+	if values["CHILD_PID"] != "43" || values["UPDATE_EVENT"] != "switch" {
+		t.Fatalf("values %q", values)
+	}
+}
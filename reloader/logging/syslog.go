@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// syslog "daemon" facility
+	facilityDaemon = 3
+	// structured data element id for message fields
+	sdID = "fields@32473"
+)
+
+// Syslog is a writer sending each line as RFC 5424 syslog message.
+type Syslog struct {
+	fields
+	lines
+	network  string
+	addr     string
+	tag      string
+	priority Priority
+	hostname string
+	mu       sync.Mutex
+	conn     net.Conn
+}
+
+// Write sends every complete line of p as separate syslog message, incomplete line is buffered. Lines failed to send
+// are dropped as syslog(3) does and p is always consumed, so copying child output is not stopped by sink failures.
+func (s *Syslog) Write(p []byte) (int, error) {
+	for _, line := range s.lines.split(p) {
+		_ = s.send(line, nil)
+	}
+	return len(p), nil
+}
+
+// WriteFields sends p as a single syslog message with additional structured data.
+func (s *Syslog) WriteFields(p []byte, fields map[string]string) (int, error) {
+	if err := s.send(bytes.TrimRight(p, "\n"), fields); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close flushes incomplete line and closes syslog connection.
+func (s *Syslog) Close() error {
+	if line := s.lines.flush(); len(line) > 0 {
+		if err := s.send(line, nil); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+// send formats a message and writes it to connection, reconnecting once on failure.
+func (s *Syslog) send(msg []byte, extra map[string]string) error {
+	data := s.format(msg, extra)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.conn.Write(data); err != nil {
+		conn, dialErr := net.Dial(s.network, s.addr)
+		if dialErr != nil {
+			return err
+		}
+		_ = s.conn.Close()
+		s.conn = conn
+		_, err = s.conn.Write(data)
+		return err
+	}
+	return nil
+}
+
+// format builds RFC 5424 message: <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+func (s *Syslog) format(msg []byte, extra map[string]string) []byte {
+	var b bytes.Buffer
+	_, _ = fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ",
+		facilityDaemon*8+int(s.priority),
+		time.Now().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, s.tag, os.Getpid())
+	names, values := s.fields.merge(extra)
+	if len(names) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + sdID)
+		for _, name := range names {
+			_, _ = fmt.Fprintf(&b, " %s=\"%s\"", name, escapeParam(values[name]))
+		}
+		b.WriteString("]")
+	}
+	b.WriteByte(' ')
+	b.Write(msg)
+	return b.Bytes()
+}
+
+// escapeParam escapes structured data parameter value.
+func escapeParam(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
+
+// NewSyslog connects to syslog daemon via unixgram or udp network.
+func NewSyslog(network, addr, tag string, priority Priority) (*Syslog, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &Syslog{
+		network:  network,
+		addr:     addr,
+		tag:      tag,
+		priority: priority,
+		hostname: hostname,
+		conn:     conn,
+	}, nil
+}
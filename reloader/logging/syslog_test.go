@@ -0,0 +1,65 @@
+// +build linux
+
+package logging
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSyslog(t *testing.T) {
+	l, path, cleanup := listenUnixgram(t)
+	defer cleanup()
+	w, err := Open("syslog:"+path, "app", Warning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := w.(*Syslog)
+	s.SetField("CHILD_PID", "42")
+	if n, err := s.Write([]byte("first\nsecond")); err != nil || n != 12 {
+		t.Fatalf("write %d, %v", n, err)
+	}
+	if _, err := s.WriteFields([]byte("switching\n"), map[string]string{"UPDATE_EVENT": `sw"it]ch`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// daemon facility is 3, warning priority is 4
+	header := `^<28>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ \S+ app \d+ - `
+	expected := []string{
+		header + `\[fields@32473 CHILD_PID="42"\] first$`,
+		header + `\[fields@32473 CHILD_PID="42" UPDATE_EVENT="sw\\"it\\]ch"\] switching$`,
+		header + `\[fields@32473 CHILD_PID="42"\] second$`,
+	}
+	buf := make([]byte, 4096)
+	for _, pattern := range expected {
+		if err := l.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, err := l.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(pattern).Match(buf[:n]) {
+			t.Fatalf("message %q doesn't match %s", buf[:n], pattern)
+		}
+	}
+}
+
+func TestSyslogDaemonGone(t *testing.T) {
+	_, path, cleanup := listenUnixgram(t)
+	s, err := NewSyslog("unixgram", path, "app", Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	// child output copying is not stopped when messages can't be sent
+	if n, err := s.Write([]byte("lost\n")); err != nil || n != 5 {
+		t.Fatalf("write %d, %v", n, err)
+	}
+	if _, err := s.WriteFields([]byte("lost"), nil); err == nil {
+		t.Fatal("expected error for message with fields")
+	}
+}
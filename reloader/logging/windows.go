@@ -0,0 +1,12 @@
+// +build windows
+
+package logging
+
+import (
+	"net"
+)
+
+// sendLarge returns send error err as is, journald is not available on Windows.
+func sendLarge(conn *net.UnixConn, data []byte, err error) error {
+	return err
+}
@@ -0,0 +1,168 @@
+package reloader
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// exitLabels identifies child exits counted together.
+type exitLabels struct {
+	code   string
+	signal string
+}
+
+// metricsFile is an observer writing child process metrics to a file in Prometheus text format,
+// i.e. for node_exporter textfile collector. File is replaced atomically after each child start and exit.
+type metricsFile struct {
+	path   string
+	child  string
+	logger *log.Logger
+
+	mu       sync.Mutex
+	up       bool
+	starts   int
+	exits    map[exitLabels]int
+	failures int
+	last     *executable.ExitStatus
+	lastAt   float64
+}
+
+// newMetricsFile returns metrics observer for child writing to path.
+func newMetricsFile(path, child string, logger *log.Logger) *metricsFile {
+	return &metricsFile{path: path, child: child, logger: logger, exits: make(map[exitLabels]int)}
+}
+
+// OnEvent counts child starts and exits and writes metrics file.
+func (m *metricsFile) OnEvent(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch e := e.(type) {
+	case ChildStarted:
+		m.up = true
+		m.starts++
+	case ChildExited:
+		s := e.Status
+		m.up = false
+		code := strconv.Itoa(s.Code)
+		if s.Unknown {
+			code = "unknown"
+		}
+		m.exits[exitLabels{code: code, signal: s.Signal}]++
+		if s.Failure() {
+			m.failures++
+		}
+		m.last = &s
+		m.lastAt = float64(e.At.UnixNano()) / 1e9
+	default:
+		return
+	}
+	m.write()
+}
+
+// write replaces metrics file atomically, so collector never reads partially written file. Errors are logged
+// as metrics don't affect child supervision.
+func (m *metricsFile) write() {
+	f, err := ioutil.TempFile(filepath.Dir(m.path), "."+filepath.Base(m.path))
+	if err != nil {
+		m.logger.Printf("metrics file error: %s", err.Error())
+		return
+	}
+	_, err = f.Write(m.format())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), m.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		m.logger.Printf("metrics file error: %s", err.Error())
+	}
+}
+
+// format returns metrics in Prometheus text format.
+func (m *metricsFile) format() []byte {
+	var b bytes.Buffer
+	child := `child="` + escapeLabel(m.child) + `"`
+	metric := func(name, help, typ string) {
+		_, _ = fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	up := 0
+	if m.up {
+		up = 1
+	}
+	metric("reloader_child_up", "Whether child process is running.", "gauge")
+	_, _ = fmt.Fprintf(&b, "reloader_child_up{%s} %d\n", child, up)
+	metric("reloader_child_starts_total", "Child process starts.", "counter")
+	_, _ = fmt.Fprintf(&b, "reloader_child_starts_total{%s} %d\n", child, m.starts)
+	metric("reloader_child_exits_total", "Child process exits by exit code and terminating signal.", "counter")
+	labels := make([]exitLabels, 0, len(m.exits))
+	for l := range m.exits {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].code != labels[j].code {
+			return labels[i].code < labels[j].code
+		}
+		return labels[i].signal < labels[j].signal
+	})
+	for _, l := range labels {
+		_, _ = fmt.Fprintf(&b, "reloader_child_exits_total{%s,code=\"%s\",signal=\"%s\"} %d\n",
+			child, l.code, escapeLabel(l.signal), m.exits[l])
+	}
+	metric("reloader_child_failures_total", "Child process exits with non-zero code or by signal.", "counter")
+	_, _ = fmt.Fprintf(&b, "reloader_child_failures_total{%s} %d\n", child, m.failures)
+	if m.last == nil {
+		return b.Bytes()
+	}
+	s := m.last
+	core := 0
+	if s.CoreDump {
+		core = 1
+	}
+	metric("reloader_child_last_exit_code", "Last child exit code, -1 if terminated by signal or unknown.", "gauge")
+	_, _ = fmt.Fprintf(&b, "reloader_child_last_exit_code{%s} %d\n", child, s.Code)
+	metric("reloader_child_last_exit_signal", "Number of signal terminated last child, 0 if it exited by itself.", "gauge")
+	_, _ = fmt.Fprintf(&b, "reloader_child_last_exit_signal{%s} %d\n", child, s.SignalNumber)
+	metric("reloader_child_last_exit_core_dumped", "Whether last child dumped core.", "gauge")
+	_, _ = fmt.Fprintf(&b, "reloader_child_last_exit_core_dumped{%s} %d\n", child, core)
+	metric("reloader_child_last_exit_timestamp_seconds", "Time of last child exit.", "gauge")
+	_, _ = fmt.Fprintf(&b, "reloader_child_last_exit_timestamp_seconds{%s} %.3f\n", child, m.lastAt)
+	metric("reloader_child_last_run_duration_seconds", "Run duration of last exited child.", "gauge")
+	_, _ = fmt.Fprintf(&b, "reloader_child_last_run_duration_seconds{%s} %.3f\n", child, s.Duration.Seconds())
+	metric("reloader_child_last_cpu_seconds", "CPU time spent by last exited child.", "gauge")
+	_, _ = fmt.Fprintf(&b, "reloader_child_last_cpu_seconds{%s,mode=\"user\"} %.3f\n", child, s.UserTime.Seconds())
+	_, _ = fmt.Fprintf(&b, "reloader_child_last_cpu_seconds{%s,mode=\"system\"} %.3f\n", child, s.SystemTime.Seconds())
+	metric("reloader_child_last_max_rss_bytes", "Maximum resident set size of last exited child, 0 if unknown.", "gauge")
+	_, _ = fmt.Fprintf(&b, "reloader_child_last_max_rss_bytes{%s} %d\n", child, s.MaxRSS)
+	return b.Bytes()
+}
+
+// escapeLabel escapes label value for Prometheus text format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// openMetrics registers metrics file observer once and writes initial metrics.
+func (r *Reloader) openMetrics() {
+	if r.metricsFile == "" || r.metrics != nil {
+		return
+	}
+	r.metrics = newMetricsFile(r.metricsFile, filepath.Base(r.child), r.logger)
+	r.AddObserver(r.metrics)
+	r.metrics.mu.Lock()
+	r.metrics.write()
+	r.metrics.mu.Unlock()
+}
@@ -0,0 +1,89 @@
+package reloader
+
+import (
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "app.prom")
+	killed := ChildExited{Timestamp: Timestamp{At: time.Unix(1579539821, 0)}, Code: -1, Status: executable.ExitStatus{
+		Code: -1, Signal: "killed", SignalNumber: 9, CoreDump: true, UserTime: 1500 * time.Millisecond,
+		SystemTime: time.Second, MaxRSS: 4096, Duration: time.Minute}}
+	m := newMetricsFile(path, `app"1`, log.New(ioutil.Discard, "", 0))
+	m.OnEvent(ChildStarted{Timestamp: now(), PID: 1})
+	m.OnEvent(killed)
+	m.OnEvent(ChildStarted{Timestamp: now(), PID: 2})
+	m.OnEvent(ChildExited{Timestamp: now(), Status: executable.ExitStatus{Code: 0}})
+	m.OnEvent(ChildStarted{Timestamp: now(), PID: 3})
+	// other events don't change metrics
+	m.OnEvent(Switched{Timestamp: now()})
+	m.OnEvent(killed)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			samples = append(samples, line)
+		}
+	}
+	expected := []string{
+		`reloader_child_up{child="app\"1"} 0`,
+		`reloader_child_starts_total{child="app\"1"} 3`,
+		`reloader_child_exits_total{child="app\"1",code="-1",signal="killed"} 2`,
+		`reloader_child_exits_total{child="app\"1",code="0",signal=""} 1`,
+		`reloader_child_failures_total{child="app\"1"} 2`,
+		`reloader_child_last_exit_code{child="app\"1"} -1`,
+		`reloader_child_last_exit_signal{child="app\"1"} 9`,
+		`reloader_child_last_exit_core_dumped{child="app\"1"} 1`,
+		`reloader_child_last_exit_timestamp_seconds{child="app\"1"} 1579539821.000`,
+		`reloader_child_last_run_duration_seconds{child="app\"1"} 60.000`,
+		`reloader_child_last_cpu_seconds{child="app\"1",mode="user"} 1.500`,
+		`reloader_child_last_cpu_seconds{child="app\"1",mode="system"} 1.000`,
+		`reloader_child_last_max_rss_bytes{child="app\"1"} 4096`,
+	}
+	if strings.Join(samples, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected metrics:\n%s", data)
+	}
+	// temporary files are not left behind
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Fatalf("files %v, %v", files, err)
+	}
+}
+
+func TestMetricsFileRun(t *testing.T) {
+	s := newSupervisor(t, "exit 3", WithExitCode(true))
+	path := filepath.Join(s.dir, "app.prom")
+	if err := s.SetMetricsFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(); err == nil {
+		t.Fatal("child exit is not reported")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sample := range []string{
+		`reloader_child_starts_total{child="child"} 1`,
+		`reloader_child_exits_total{child="child",code="3",signal=""} 1`,
+		`reloader_child_last_exit_code{child="child"} 3`,
+	} {
+		if !strings.Contains(string(data), sample+"\n") {
+			t.Errorf("%s is missing in:\n%s", sample, data)
+		}
+	}
+}
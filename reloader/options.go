@@ -0,0 +1,413 @@
+package reloader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/schedule"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"github.com/tumb1er/go-reloader/reloader/version"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Option configures a Reloader created with New.
+type Option func(r *Reloader) error
+
+// MultiError is a list of configuration errors.
+type MultiError []error
+
+// Error joins all error messages.
+func (m MultiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// WithVersion sets reloader version.
+func WithVersion(version string) Option {
+	return func(r *Reloader) error {
+		r.version = version
+		return nil
+	}
+}
+
+// WithChild sets child executable and it's arguments.
+func WithChild(child string, args ...string) Option {
+	return func(r *Reloader) error {
+		path, err := filepath.Abs(child)
+		if err != nil {
+			return err
+		}
+		r.SetChild(path, args...)
+		return nil
+	}
+}
+
+// WithStaging sets updates directory path.
+func WithStaging(staging string) Option {
+	return func(r *Reloader) error {
+		return r.SetStaging(staging)
+	}
+}
+
+// WithUpdateSource sets update source used instead of staging directory.
+func WithUpdateSource(s source.UpdateSource) Option {
+	return func(r *Reloader) error {
+		r.SetUpdateSource(s)
+		return nil
+	}
+}
+
+// WithReleases enables bundle updates installed to versioned release directories under root.
+func WithReleases(root string) Option {
+	return func(r *Reloader) error {
+		return r.SetReleases(root)
+	}
+}
+
+// WithStateDir sets directory keeping update history and bad builds across restarts.
+func WithStateDir(dir string) Option {
+	return func(r *Reloader) error {
+		return r.SetStateDir(dir)
+	}
+}
+
+// WithAuditLog sets append-only audit log of binary replacements and restarts.
+func WithAuditLog(path string) Option {
+	return func(r *Reloader) error {
+		return r.SetAuditLog(path)
+	}
+}
+
+// WithAuditKey sets audit log HMAC key read from file, so audit log can't be rewritten without the key.
+func WithAuditKey(path string) Option {
+	return func(r *Reloader) error {
+		return r.SetAuditKey(path)
+	}
+}
+
+// WithKeepReleases sets number of releases kept on disk, 0 keeps all releases.
+func WithKeepReleases(keep int) Option {
+	return func(r *Reloader) error {
+		r.SetKeepReleases(keep)
+		return nil
+	}
+}
+
+// WithInterval sets update check interval.
+func WithInterval(interval time.Duration) Option {
+	return func(r *Reloader) error {
+		r.SetInterval(interval)
+		return nil
+	}
+}
+
+// WithTerminateTree enables terminating child process tree.
+func WithTerminateTree(tree bool) Option {
+	return func(r *Reloader) error {
+		r.SetTerminateTree(tree)
+		return nil
+	}
+}
+
+// WithRestart enables child automatic restarts.
+func WithRestart(restart bool) Option {
+	return func(r *Reloader) error {
+		r.SetRestart(restart)
+		return nil
+	}
+}
+
+// WithRestartOnFailure enables child restarts after failures only.
+func WithRestartOnFailure(restart bool) Option {
+	return func(r *Reloader) error {
+		r.SetRestartOnFailure(restart)
+		return nil
+	}
+}
+
+// WithExitCode makes Run return ChildExitError when child exits and is not restarted.
+func WithExitCode(exitCode bool) Option {
+	return func(r *Reloader) error {
+		r.SetExitCode(exitCode)
+		return nil
+	}
+}
+
+// WithLogger sets reloader logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(r *Reloader) error {
+		r.SetLogger(logger)
+		return nil
+	}
+}
+
+// WithStdout sets child process stdout redirection.
+func WithStdout(w io.Writer) Option {
+	return func(r *Reloader) error {
+		r.SetStdout(w)
+		return nil
+	}
+}
+
+// WithStderr sets child process stderr redirection.
+func WithStderr(w io.Writer) Option {
+	return func(r *Reloader) error {
+		r.SetStderr(w)
+		return nil
+	}
+}
+
+// WithHook registers a lifecycle event hook.
+func WithHook(event HookEvent, hook Hook) Option {
+	return func(r *Reloader) error {
+		r.AddHook(event, hook)
+		return nil
+	}
+}
+
+// WithObserver registers a lifecycle events observer.
+func WithObserver(o Observer) Option {
+	return func(r *Reloader) error {
+		r.AddObserver(o)
+		return nil
+	}
+}
+
+// WithSignalHandling enables or disables interrupt signal handling in Run.
+func WithSignalHandling(handle bool) Option {
+	return func(r *Reloader) error {
+		r.SetHandleSignals(handle)
+		return nil
+	}
+}
+
+// WithUpdatePolicy sets when detected updates are applied.
+func WithUpdatePolicy(policy UpdatePolicy) Option {
+	return func(r *Reloader) error {
+		r.SetUpdatePolicy(policy)
+		return nil
+	}
+}
+
+// WithMaintenanceWindow adds a window for window update policy.
+func WithMaintenanceWindow(w schedule.Window) Option {
+	return func(r *Reloader) error {
+		r.AddMaintenanceWindow(w)
+		return nil
+	}
+}
+
+// WithRollout sets percentage of hosts taking an update unless source manifest sets it.
+func WithRollout(percent int) Option {
+	return func(r *Reloader) error {
+		r.SetRollout(percent)
+		return nil
+	}
+}
+
+// WithRolloutDelay sets maximum random delay before applying an update.
+func WithRolloutDelay(delay time.Duration) Option {
+	return func(r *Reloader) error {
+		r.SetRolloutDelay(delay)
+		return nil
+	}
+}
+
+// WithHostname sets host name used for rollout decisions.
+func WithHostname(host string) Option {
+	return func(r *Reloader) error {
+		r.SetHostname(host)
+		return nil
+	}
+}
+
+// WithChannel sets release channel used to select artifacts from update source manifest.
+func WithChannel(channel string) Option {
+	return func(r *Reloader) error {
+		r.SetChannel(channel)
+		return nil
+	}
+}
+
+// WithPin pins child executable to an exact version.
+func WithPin(version string) Option {
+	return func(r *Reloader) error {
+		r.SetPin(version)
+		return nil
+	}
+}
+
+// WithAllowDowngrade allows applying updates with versions older than current binary.
+func WithAllowDowngrade(allow bool) Option {
+	return func(r *Reloader) error {
+		r.SetAllowDowngrade(allow)
+		return nil
+	}
+}
+
+// WithVersionArg sets argument printing binary version, i.e. --version.
+func WithVersionArg(arg string) Option {
+	return func(r *Reloader) error {
+		r.SetVersionArg(arg)
+		return nil
+	}
+}
+
+// WithSmokeTest runs staged child binary with args before switching and requires it to exit successfully.
+func WithSmokeTest(timeout time.Duration, args ...string) Option {
+	return func(r *Reloader) error {
+		r.SetSmokeTest(timeout, args...)
+		return nil
+	}
+}
+
+// WithSelfUpdateTimeout sets time limit for updated reloader to report it is ready.
+func WithSelfUpdateTimeout(timeout time.Duration) Option {
+	return func(r *Reloader) error {
+		r.SetSelfUpdateTimeout(timeout)
+		return nil
+	}
+}
+
+// WithHandover keeps child running across reloader self updates, updated reloader adopts it.
+// Adopted child is not a subprocess of updated reloader, so it's exit status is always unknown: ChildExited
+// events report -1 exit code with Status.Unknown set and such exits are not failures.
+func WithHandover(handover bool) Option {
+	return func(r *Reloader) error {
+		r.SetHandover(handover)
+		return nil
+	}
+}
+
+// WithService sets service name reloader daemon is registered with.
+func WithService(name string) Option {
+	return func(r *Reloader) error {
+		r.SetService(name)
+		return nil
+	}
+}
+
+// WithMetricsFile writes child process metrics to a file in Prometheus text format, i.e. for node_exporter
+// textfile collector.
+func WithMetricsFile(path string) Option {
+	return func(r *Reloader) error {
+		return r.SetMetricsFile(path)
+	}
+}
+
+// WithReadyMarker requires <name>.ready marker files for staged updates.
+func WithReadyMarker(required bool) Option {
+	return func(r *Reloader) error {
+		r.SetReadyMarker(required)
+		return nil
+	}
+}
+
+// WithControl enables control interface on a unix socket.
+func WithControl(path string) Option {
+	return func(r *Reloader) error {
+		return r.SetControl(path)
+	}
+}
+
+// Validate checks configuration and returns MultiError listing all problems found.
+func (c *Config) Validate() error {
+	var errs MultiError
+	if c.child == "" {
+		errs = append(errs, errors.New("child executable is not set"))
+	} else if fi, err := os.Stat(c.child); err != nil {
+		// first release may be installed from staging directory on start
+		if !os.IsNotExist(err) || c.releases == nil {
+			errs = append(errs, fmt.Errorf("child executable: %s", err.Error()))
+		}
+	} else if fi.IsDir() {
+		errs = append(errs, fmt.Errorf("child executable %s is a directory", c.child))
+	}
+	if c.keepReleases < 0 {
+		errs = append(errs, fmt.Errorf("number of kept releases must not be negative, got %d", c.keepReleases))
+	}
+	switch c.policy {
+	case PolicyImmediate, PolicyManual:
+	case PolicyWindow:
+		if len(c.windows) == 0 {
+			errs = append(errs, errors.New("window update policy requires maintenance windows"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown update policy %q", c.policy))
+	}
+	if c.rollout < 0 || c.rollout > 100 {
+		errs = append(errs, fmt.Errorf("rollout percentage must be within 0..100, got %d", c.rollout))
+	}
+	if c.rolloutDelay < 0 {
+		errs = append(errs, fmt.Errorf("rollout delay must not be negative, got %s", c.rolloutDelay))
+	}
+	if c.pin != "" {
+		if _, err := version.Parse(c.pin); err != nil {
+			errs = append(errs, fmt.Errorf("pinned version: %s", err.Error()))
+		}
+	}
+	if len(c.smoke) > 0 && c.smokeTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("smoke test timeout must be positive, got %s", c.smokeTimeout))
+	}
+	if c.selfUpdateTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("self update timeout must be positive, got %s", c.selfUpdateTimeout))
+	}
+	if c.handover && runtime.GOOS == "windows" {
+		errs = append(errs, errors.New("child handover is not supported on windows"))
+	}
+	if c.handover && c.service != "" {
+		// service manager stops child with previous reloader
+		errs = append(errs, errors.New("child handover is not supported in daemon mode"))
+	}
+	if c.interval <= 0 {
+		errs = append(errs, fmt.Errorf("update check interval must be positive, got %s", c.interval))
+	}
+	// staging directory is not watched when another update source is set
+	if c.source == nil {
+		if fi, err := os.Stat(c.staging); err != nil {
+			errs = append(errs, fmt.Errorf("staging directory: %s", err.Error()))
+		} else if !fi.IsDir() {
+			errs = append(errs, fmt.Errorf("staging %s is not a directory", c.staging))
+		}
+	}
+	if c.logger == nil {
+		errs = append(errs, errors.New("logger is not set"))
+	}
+	if c.stdout == nil || c.stderr == nil {
+		errs = append(errs, errors.New("child stdout and stderr must be set"))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// New returns a new Reloader configured with options, validating whole configuration.
+// All option and validation errors are returned as MultiError.
+func New(opts ...Option) (*Reloader, error) {
+	r := NewReloader("")
+	var errs MultiError
+	if err := r.SetStaging(r.staging); err != nil {
+		errs = append(errs, err)
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := r.Validate(); err != nil {
+		errs = append(errs, err.(MultiError)...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return r, nil
+}
@@ -0,0 +1,128 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noUpdates is an update source never finding updates.
+type noUpdates struct{}
+
+// Check returns ErrNoUpdate.
+func (noUpdates) Check(context.Context, *executable.Executable) (source.Candidate, error) {
+	return source.Candidate{}, source.ErrNoUpdate
+}
+
+// Fetch returns ErrNoUpdate.
+func (noUpdates) Fetch(context.Context, source.Candidate) (string, error) {
+	return "", source.ErrNoUpdate
+}
+
+// newOptionsDir returns temporary directory with child binary and staging directory.
+func newOptionsDir(t *testing.T) (child, staging string) {
+	dir, err := ioutil.TempDir("", "options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	child = filepath.Join(dir, "app")
+	if err := ioutil.WriteFile(child, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	staging = filepath.Join(dir, "staging")
+	if err := os.Mkdir(staging, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return child, staging
+}
+
+func TestNew(t *testing.T) {
+	child, staging := newOptionsDir(t)
+	r, err := New(
+		WithVersion("1.0.0"),
+		WithChild(child, "-v"),
+		WithStaging(staging),
+		WithInterval(time.Second),
+		WithRollout(50),
+		WithExitCode(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.version != "1.0.0" || r.child != child || r.staging != staging || r.interval != time.Second ||
+		r.rollout != 50 || !r.exitCode || len(r.args) != 1 || r.args[0] != "-v" {
+		t.Fatalf("unexpected config %+v", r.Config)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	child, staging := newOptionsDir(t)
+	missing := filepath.Join(staging, "missing")
+	testCases := []struct {
+		name string
+		opts []Option
+		// expected error messages, empty if configuration is valid
+		errs []string
+	}{
+		{"valid", nil, nil},
+		{"missing child", []Option{WithChild(missing)}, []string{"child executable: "}},
+		{"child is a directory", []Option{WithChild(staging)}, []string{"is a directory"}},
+		{"missing child installed from staging", []Option{WithChild(missing), WithReleases(staging)}, nil},
+		{"missing staging", []Option{WithStaging(missing)}, []string{"staging directory: "}},
+		{"staging is a file", []Option{WithStaging(child)}, []string{"is not a directory"}},
+		{"missing staging with update source", []Option{WithStaging(missing), WithUpdateSource(noUpdates{})}, nil},
+		{"window policy without windows", []Option{WithUpdatePolicy(PolicyWindow)},
+			[]string{"window update policy requires maintenance windows"}},
+		{"unknown policy", []Option{WithUpdatePolicy("later")}, []string{`unknown update policy "later"`}},
+		{"bad pin", []Option{WithPin("latest")}, []string{"pinned version: "}},
+		{"all errors", []Option{WithRollout(101), WithRolloutDelay(-time.Second), WithInterval(0), WithKeepReleases(-1)},
+			[]string{"number of kept releases", "rollout percentage", "rollout delay", "update check interval"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]Option{WithChild(child), WithStaging(staging)}, tc.opts...)
+			_, err := New(opts...)
+			if len(tc.errs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var errs MultiError
+			if !errors.As(err, &errs) {
+				t.Fatalf("error %v, expected MultiError", err)
+			}
+			if len(errs) != len(tc.errs) {
+				t.Fatalf("errors %v, expected %d", errs, len(tc.errs))
+			}
+			for i, msg := range tc.errs {
+				if !strings.Contains(errs[i].Error(), msg) {
+					t.Errorf("error %q, expected %q", errs[i], msg)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiError(t *testing.T) {
+	err := MultiError{errors.New("first"), errors.New("second")}
+	if err.Error() != "first; second" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+	// option and validation errors are reported together
+	child, staging := newOptionsDir(t)
+	_, err2 := New(WithChild(child), WithStaging(staging), WithAuditKey(filepath.Join(staging, "key")),
+		WithInterval(0))
+	var errs MultiError
+	if !errors.As(err2, &errs) || len(errs) != 2 {
+		t.Fatalf("error %v, expected option and validation errors", err2)
+	}
+}
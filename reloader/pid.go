@@ -0,0 +1,108 @@
+package reloader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrRunning is returned by CheckStopped when reloader running the same child executable may exist.
+var ErrRunning = errors.New("reloader is running")
+
+// runtimeDir returns directory for pid files of reloaders without state directory.
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// pidPath returns pid file path in state directory or in runtime directory. Pid file name is derived from child
+// executable name and path, so reloaders running different children don't share it.
+func (r *Reloader) pidPath() string {
+	child, err := filepath.Abs(r.child)
+	if err != nil {
+		child = r.child
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(child))
+	name := fmt.Sprintf("reloader-%s-%08x.pid", filepath.Base(child), h.Sum32())
+	if r.stateDir != "" {
+		return filepath.Join(r.stateDir, name)
+	}
+	return filepath.Join(runtimeDir(), name)
+}
+
+// writePid records current process as reloader running child executable. Pid file is replaced atomically,
+// so a file or symlink planted in shared runtime directory is not written through.
+func (r *Reloader) writePid() error {
+	path := r.pidPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".reloader-pid")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// recordPid writes pid file, failure is logged as pid file only guards commands switching child directly.
+func (r *Reloader) recordPid() {
+	if err := r.writePid(); err != nil {
+		r.logger.Printf("pid file error: %s", err.Error())
+	}
+}
+
+// removePid removes pid file if it is written by current process, so pid file of updated reloader is kept.
+func (r *Reloader) removePid() {
+	if pid, err := readPid(r.pidPath()); err == nil && pid == os.Getpid() {
+		_ = os.Remove(r.pidPath())
+	}
+}
+
+// readPid reads reloader pid from file at path.
+func readPid(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// CheckStopped returns ErrRunning unless it is certain that no reloader is running the same child executable,
+// i.e. pid file is missing or process it names has exited. Reloader killed without cleanup leaves pid file, which is
+// ignored when it's pid is not reused.
+func (r *Reloader) CheckStopped() error {
+	path := r.pidPath()
+	pid, err := readPid(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: can't read pid file %s: %s", ErrRunning, path, err.Error())
+	}
+	if pid == os.Getpid() || !executable.Running(pid) {
+		return nil
+	}
+	return fmt.Errorf("%w with pid %d (%s)", ErrRunning, pid, path)
+}
@@ -0,0 +1,152 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPidPath(t *testing.T) {
+	child, staging := newOptionsDir(t)
+	other := filepath.Join(filepath.Dir(child), "other", "app")
+	r := newTestReloader()
+	r.child = child
+	path := r.pidPath()
+	// pid file is not kept in staging directory
+	if filepath.Dir(path) != runtimeDir() || !strings.HasPrefix(filepath.Base(path), "reloader-app-") {
+		t.Fatalf("pid file %s", path)
+	}
+	// children with the same name in different directories don't share pid file
+	r.child = other
+	if r.pidPath() == path {
+		t.Fatalf("pid file %s is shared", path)
+	}
+	r.child = child
+	if err := r.SetStateDir(staging); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(r.pidPath()) != staging {
+		t.Fatalf("pid file %s is not in state directory", r.pidPath())
+	}
+}
+
+func TestCheckStopped(t *testing.T) {
+	// process running while test runs
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	// process that has exited
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skip(err)
+	}
+	testCases := []struct {
+		name    string
+		content string
+		running bool
+	}{
+		{"missing", "", false},
+		{"current process", strconv.Itoa(os.Getpid()), false},
+		{"running", strconv.Itoa(cmd.Process.Pid), true},
+		{"exited", strconv.Itoa(exited.Process.Pid), false},
+		{"malformed", "pid", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			child, staging := newOptionsDir(t)
+			r := newTestReloader()
+			r.child = child
+			if err := r.SetStateDir(staging); err != nil {
+				t.Fatal(err)
+			}
+			if tc.content != "" {
+				if err := ioutil.WriteFile(r.pidPath(), []byte(tc.content+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := r.CheckStopped()
+			if running := errors.Is(err, ErrRunning); running != tc.running {
+				t.Fatalf("error %v, running %v expected", err, tc.running)
+			}
+		})
+	}
+}
+
+func TestWritePid(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges")
+	}
+	child, staging := newOptionsDir(t)
+	r := newTestReloader()
+	r.child = child
+	if err := r.SetStateDir(staging); err != nil {
+		t.Fatal(err)
+	}
+	// symlink planted at pid file path is replaced, not written through
+	target := filepath.Join(staging, "target")
+	if err := os.Symlink(target, r.pidPath()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.writePid(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("pid is written through symlink: %v", err)
+	}
+	if pid, err := readPid(r.pidPath()); err != nil || pid != os.Getpid() {
+		t.Fatalf("pid %d, %v", pid, err)
+	}
+	// pid file of another reloader is kept
+	if err := ioutil.WriteFile(r.pidPath(), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.removePid()
+	if _, err := os.Stat(r.pidPath()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.writePid(); err != nil {
+		t.Fatal(err)
+	}
+	r.removePid()
+	if _, err := os.Stat(r.pidPath()); !os.IsNotExist(err) {
+		t.Fatalf("pid file is not removed: %v", err)
+	}
+}
+
+func TestPidFileError(t *testing.T) {
+	// pid file can't be written to runtime directory that is a file
+	s := newSupervisor(t, "exec sleep 10")
+	dir := filepath.Join(s.dir, "runtime")
+	if err := ioutil.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	prev, set := os.LookupEnv("XDG_RUNTIME_DIR")
+	if err := os.Setenv("XDG_RUNTIME_DIR", dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if set {
+			_ = os.Setenv("XDG_RUNTIME_DIR", prev)
+		} else {
+			_ = os.Unsetenv("XDG_RUNTIME_DIR")
+		}
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := s.start(t, ctx)
+	cancel()
+	if err := wait(t, result); err != context.Canceled {
+		t.Fatalf("error %v, expected %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,137 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"github.com/tumb1er/go-reloader/reloader/audit"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/release"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"github.com/tumb1er/go-reloader/reloader/state"
+	"time"
+)
+
+// planSettle is a delay between update checks, so staged files unchanged since first check are ready.
+const planSettle = time.Second
+
+// PlannedAction is an action reloader would take on current update source contents.
+type PlannedAction struct {
+	// switch, rollback, self-update or restart; hold, refuse, wait, ignore or error if update is not applied
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	// current and new binary checksums and versions
+	From        string `json:"from,omitempty"`
+	To          string `json:"to,omitempty"`
+	FromVersion string `json:"from_version,omitempty"`
+	ToVersion   string `json:"to_version,omitempty"`
+	Location    string `json:"location,omitempty"`
+	// why update is not applied or what is checked only when it is applied
+	Reason string `json:"reason,omitempty"`
+}
+
+// Plan checks child and reloader for updates with the same rules as Run and returns actions Run would take now.
+// Nothing is fetched, switched or restarted and event hooks are not run. Staged binaries are validated in place,
+// remote updates, delta patches and bundles are validated only when they are applied.
+// Staged binaries are executed as Run does: with version argument to probe their versions and with smoke test
+// arguments to validate them.
+func (r *Reloader) Plan(ctx context.Context) ([]PlannedAction, error) {
+	if err := r.initSelf(); err != nil {
+		return nil, &Error{Op: "self init", Err: err}
+	}
+	if err := r.initChild(); err != nil {
+		return nil, &Error{Op: "child init", Err: err}
+	}
+	if r.stateDir != "" {
+		st, err := state.Read(r.stateDir)
+		if err != nil {
+			return nil, &Error{Op: "state read", Err: err}
+		}
+		r.restoreFailures(st)
+	}
+	var actions []PlannedAction
+	for _, cmd := range []*executable.Executable{r.cmd, r.self} {
+		c, err := r.checkSettled(ctx, cmd)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return nil, err
+		}
+		actions = append(actions, r.plan(ctx, cmd, c, err)...)
+	}
+	return actions, nil
+}
+
+// checkSettled checks cmd for update once, or twice if staged file is not ready yet, so staged files unchanged
+// since first check are ready.
+func (r *Reloader) checkSettled(ctx context.Context, cmd *executable.Executable) (source.Candidate, error) {
+	c, err := r.updateSource().Check(ctx, cmd)
+	if !errors.Is(err, source.ErrNotReady) || r.readyMarker {
+		return c, err
+	}
+	select {
+	case <-time.After(planSettle):
+	case <-ctx.Done():
+		return c, ctx.Err()
+	}
+	return r.updateSource().Check(ctx, cmd)
+}
+
+// plan returns actions for update check result of cmd.
+func (r *Reloader) plan(ctx context.Context, cmd *executable.Executable, c source.Candidate, err error) []PlannedAction {
+	a := PlannedAction{Name: cmd.String(), From: cmd.Checksum(), FromVersion: cmd.Version()}
+	if err == source.ErrNoUpdate {
+		return nil
+	}
+	if err != nil {
+		a.Action = "error"
+		if errors.Is(err, source.ErrNotReady) {
+			a.Action = "wait"
+		}
+		a.Reason = err.Error()
+		return []PlannedAction{a}
+	}
+	a.To, a.ToVersion, a.Location = c.Checksum, c.Version, c.Location
+	if reason, ignore := r.screen(cmd, c); ignore {
+		if reason == "" {
+			return nil
+		}
+		a.Action, a.Reason = "ignore", reason
+		return []PlannedAction{a}
+	} else if reason != "" {
+		a.Action, a.Reason = "refuse", reason
+		return []PlannedAction{a}
+	}
+	if r.rolloutDelay > 0 && !c.Modified.IsZero() && !r.isPending(cmd, c) {
+		// running reloader delays update since it is detected, that is about when it is staged or published
+		if r.pending == nil {
+			r.pending = make(map[string]Pending)
+		}
+		r.pending[cmd.String()] = Pending{Name: cmd.String(), Version: c.Version, Checksum: c.Checksum,
+			Detected: c.Modified, Build: c.Build}
+	}
+	if reason := r.holdReason(ctx, cmd, c, time.Now()); reason != "" {
+		a.Action, a.Reason = "hold", reason
+		return []PlannedAction{a}
+	}
+	if r.source == nil && c.Base == "" && !release.IsBundle(c.Location) {
+		if err := r.validate(cmd, c.Location); err != nil {
+			a.Action, a.Reason = "refuse", err.Error()
+			return []PlannedAction{a}
+		}
+	} else {
+		a.Reason = "validated when fetched"
+	}
+	restart := PlannedAction{Action: audit.Restart, Name: r.cmd.String(), From: r.cmd.Checksum(), To: r.cmd.Checksum(),
+		FromVersion: r.cmd.Version(), ToVersion: r.cmd.Version()}
+	if cmd == r.self {
+		a.Action = audit.SelfUpdate
+		if r.handover {
+			// updated reloader adopts running child
+			return []PlannedAction{a}
+		}
+		restart.Reason = "updated reloader starts new child"
+		return []PlannedAction{a, restart}
+	}
+	a.Action = switchAction(cmd.Version(), c.Version)
+	restart.To, restart.ToVersion = c.Checksum, c.Version
+	restart.Reason = "child is restarted with new binary"
+	return []PlannedAction{a, restart}
+}
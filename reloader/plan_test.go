@@ -0,0 +1,77 @@
+package reloader
+
+import (
+	"context"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stagedChild is a child update printing it's version and failing smoke test with --fail argument.
+const stagedChild = "#!/bin/sh\n[ \"$1\" = --fail ] && exit 1\necho app 1.2.0\n"
+
+func TestPlan(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []Option
+		// staged file modification time offset
+		age time.Duration
+		// actions and reasons, empty reason is not checked
+		actions []string
+		reason  string
+	}{
+		{"switch", nil, 0, []string{"switch", "restart"}, ""},
+		{"smoke test passed", []Option{WithSmokeTest(time.Second, "--version")}, 0, []string{"switch", "restart"}, ""},
+		{"smoke test failed", []Option{WithSmokeTest(time.Second, "--fail")}, 0, []string{"refuse"}, "exit status 1"},
+		{"pinned", []Option{WithPin("1.3.0")}, 0, []string{"refuse"}, "pinned"},
+		{"manual policy", []Option{WithUpdatePolicy(PolicyManual)}, 0, []string{"hold"}, ""},
+		// rollout delay is counted from staged file modification time
+		{"rollout delay", []Option{WithRolloutDelay(time.Hour)}, 0, []string{"hold"}, "rollout delay until"},
+		{"rollout delay passed", []Option{WithRolloutDelay(time.Hour)}, -2 * time.Hour, []string{"switch", "restart"}, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]Option{WithVersionArg("--version"), WithReadyMarker(true), WithHostname("host")},
+				tc.opts...)
+			s := newSupervisor(t, `[ "$1" = --version ] && echo app 1.1.0`, opts...)
+			staged := filepath.Join(s.staging, "child")
+			if err := ioutil.WriteFile(staged, []byte(stagedChild), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(staged+source.ReadySuffix, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			modified := time.Now().Add(tc.age)
+			for _, path := range []string{staged, staged + source.ReadySuffix} {
+				if err := os.Chtimes(path, modified, modified); err != nil {
+					t.Fatal(err)
+				}
+			}
+			actions, err := s.Plan(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result []string
+			for _, a := range actions {
+				result = append(result, a.Action)
+			}
+			if strings.Join(result, " ") != strings.Join(tc.actions, " ") {
+				t.Fatalf("actions %+v, expected %v", actions, tc.actions)
+			}
+			if !strings.Contains(actions[0].Reason, tc.reason) {
+				t.Fatalf("reason %q, expected %q", actions[0].Reason, tc.reason)
+			}
+			if a := actions[0]; a.FromVersion != "1.1.0" || a.ToVersion != "1.2.0" || a.Location != staged {
+				t.Fatalf("unexpected action %+v", a)
+			}
+			// dry run doesn't switch anything
+			if data, err := ioutil.ReadFile(s.child); err != nil || strings.Contains(string(data), "1.2.0") {
+				t.Fatalf("child is switched: %v", err)
+			}
+		})
+	}
+}
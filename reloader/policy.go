@@ -0,0 +1,296 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/control"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"sort"
+	"time"
+)
+
+// UpdatePolicy defines when detected updates are applied.
+type UpdatePolicy string
+
+const (
+	// PolicyImmediate applies updates as soon as they are detected.
+	PolicyImmediate UpdatePolicy = "immediate"
+	// PolicyWindow applies updates only within maintenance windows.
+	PolicyWindow UpdatePolicy = "window"
+	// PolicyManual applies updates only on explicit apply command.
+	PolicyManual UpdatePolicy = "manual"
+)
+
+// ErrNotRunning is returned by control methods when reloader is not running.
+var ErrNotRunning = errors.New("reloader is not running")
+
+// ErrNoPending is returned by Apply when there is no update to apply.
+var ErrNoPending = errors.New("no pending update")
+
+// ParseUpdatePolicy returns update policy by name.
+func ParseUpdatePolicy(name string) (UpdatePolicy, error) {
+	switch p := UpdatePolicy(name); p {
+	case PolicyImmediate, PolicyWindow, PolicyManual:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown update policy %q", name)
+}
+
+// Pending describes an update held until it is allowed by update policy.
+type Pending struct {
+	Name     string    `json:"name"`
+	Version  string    `json:"version,omitempty"`
+	Checksum string    `json:"checksum,omitempty"`
+	Detected time.Time `json:"detected"`
+	// new binary Go build metadata, if known before fetch
+	Build *executable.BuildInfo `json:"build,omitempty"`
+	// why update is not applied yet
+	Reason string `json:"reason,omitempty"`
+}
+
+// Status describes running reloader state.
+type Status struct {
+	Version  string `json:"version"`
+	Child    string `json:"child"`
+	PID      int    `json:"pid"`
+	Checksum string `json:"checksum"`
+	// child binary version and Go build metadata, if known
+	ChildVersion string                `json:"child_version,omitempty"`
+	Build        *executable.BuildInfo `json:"build,omitempty"`
+	// reloader binary Go build metadata
+	SelfBuild *executable.BuildInfo `json:"self_build,omitempty"`
+	Release   string                `json:"release,omitempty"`
+	Policy    UpdatePolicy          `json:"policy"`
+	Channel   string                `json:"channel,omitempty"`
+	Pin       string                `json:"pin,omitempty"`
+	Pending   []Pending             `json:"pending,omitempty"`
+	// maintenance window state for window update policy
+	WindowOpen bool       `json:"window_open,omitempty"`
+	NextWindow *time.Time `json:"next_window,omitempty"`
+	// last child process exit status, if child has exited since reloader start
+	LastExit *executable.ExitStatus `json:"last_exit,omitempty"`
+}
+
+// command is a control request executed by Run loop.
+type command struct {
+	name  string
+	args  []string
+	reply chan interface{}
+}
+
+// holdReason returns why update policy or rollout settings hold an update at t, empty if it may be applied.
+func (r *Reloader) holdReason(ctx context.Context, cmd *executable.Executable, c source.Candidate, t time.Time) string {
+	if reason := r.rolloutReason(ctx, cmd, c, t); reason != "" {
+		return reason
+	}
+	switch r.policy {
+	case PolicyWindow:
+		if !r.windowOpen(t) {
+			return "waiting for maintenance window at " + r.nextWindow(t).Format(time.RFC3339)
+		}
+	case PolicyManual:
+		return "waiting for apply command"
+	}
+	return ""
+}
+
+// windowOpen checks whether any maintenance window contains t.
+func (r *Reloader) windowOpen(t time.Time) bool {
+	for _, w := range r.windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextWindow returns earliest maintenance window start after t, zero time if there are no windows.
+func (r *Reloader) nextWindow(t time.Time) time.Time {
+	var next time.Time
+	for _, w := range r.windows {
+		if start := w.Next(t); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
+
+// isPending checks whether candidate is already held as pending update.
+func (r *Reloader) isPending(cmd *executable.Executable, c source.Candidate) bool {
+	p, ok := r.pending[cmd.String()]
+	return ok && p.Checksum == c.Checksum && p.Version == c.Version
+}
+
+// detected returns time of candidate detection, t if it is not pending yet.
+func (r *Reloader) detected(cmd *executable.Executable, c source.Candidate, t time.Time) time.Time {
+	if r.isPending(cmd, c) {
+		return r.pending[cmd.String()].Detected
+	}
+	return t
+}
+
+// hold records candidate as pending update, returns false if it was already pending.
+func (r *Reloader) hold(cmd *executable.Executable, c source.Candidate, reason string) bool {
+	if r.isPending(cmd, c) {
+		p := r.pending[cmd.String()]
+		if p.Reason != reason {
+			p.Reason = reason
+			r.pending[cmd.String()] = p
+			r.logEvent("pending", "%s update is pending: %s", cmd.String(), reason)
+		}
+		return false
+	}
+	if r.pending == nil {
+		r.pending = make(map[string]Pending)
+	}
+	r.pending[cmd.String()] = Pending{
+		Name:     cmd.String(),
+		Version:  c.Version,
+		Checksum: c.Checksum,
+		Detected: time.Now(),
+		Reason:   reason,
+		Build:    c.Build,
+	}
+	r.logEvent("pending", "%s update is pending: %s", cmd.String(), reason)
+	return true
+}
+
+// refuse logs why an update is refused, once per update.
+func (r *Reloader) refuse(cmd *executable.Executable, c source.Candidate, reason string) {
+	key := c.Checksum + " " + c.Version + " " + reason
+	if r.refused[cmd.String()] == key {
+		return
+	}
+	if r.refused == nil {
+		r.refused = make(map[string]string)
+	}
+	r.refused[cmd.String()] = key
+	r.logEvent("refuse", "refusing %s version %q: %s", cmd.String(), c.Version, reason)
+}
+
+// status returns reloader state, it must be called from Run loop.
+func (r *Reloader) status() Status {
+	s := Status{
+		Version: r.version,
+		Child:   r.cmd.Path(),
+		PID:     r.cmd.Pid(),
+		Release: r.currentRelease(),
+		Policy:  r.policy,
+		Channel: r.channel,
+		Pin:     r.pin,
+	}
+	s.Checksum = r.cmd.Checksum()
+	s.ChildVersion = r.cmd.Version()
+	s.Build = r.cmd.BuildInfo()
+	s.SelfBuild = r.self.BuildInfo()
+	s.LastExit = r.lastExit
+	for _, p := range r.pending {
+		s.Pending = append(s.Pending, p)
+	}
+	sort.Slice(s.Pending, func(i, j int) bool { return s.Pending[i].Name < s.Pending[j].Name })
+	if r.policy == PolicyWindow {
+		t := time.Now()
+		s.WindowOpen = r.windowOpen(t)
+		if next := r.nextWindow(t); !next.IsZero() {
+			s.NextWindow = &next
+		}
+	}
+	return s
+}
+
+// call sends a command to Run loop and waits for result.
+func (r *Reloader) call(ctx context.Context, name string, args ...string) (interface{}, error) {
+	r.mu.Lock()
+	done, commands := r.done, r.commands
+	r.mu.Unlock()
+	if done == nil {
+		return nil, ErrNotRunning
+	}
+	cmd := command{name: name, args: args, reply: make(chan interface{}, 1)}
+	select {
+	case commands <- cmd:
+	case <-done:
+		return nil, ErrNotRunning
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case result := <-cmd.reply:
+		if err, ok := result.(error); ok {
+			return nil, err
+		}
+		return result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Status returns running reloader state.
+func (r *Reloader) Status(ctx context.Context) (Status, error) {
+	result, err := r.call(ctx, "status")
+	if err != nil {
+		return Status{}, err
+	}
+	return result.(Status), nil
+}
+
+// Apply applies pending or newly detected update regardless of update policy.
+func (r *Reloader) Apply(ctx context.Context) error {
+	return r.ApplyVersion(ctx, "")
+}
+
+// ApplyVersion applies child update with version v regardless of update policy, pin and version ordering.
+// Empty version applies pending or newly detected update like Apply.
+func (r *Reloader) ApplyVersion(ctx context.Context, v string) error {
+	_, err := r.call(ctx, "apply", v)
+	return err
+}
+
+// Rollback switches child back to previous binary or release and restarts it. Release or version to rolls back
+// to an older installed release, empty one rolls back to previous release or to backup of binary replaced last.
+func (r *Reloader) Rollback(ctx context.Context, to string) error {
+	_, err := r.call(ctx, "rollback", to)
+	return err
+}
+
+// Restart restarts child process with current binary.
+func (r *Reloader) Restart(ctx context.Context) error {
+	_, err := r.call(ctx, "restart")
+	return err
+}
+
+// firstArg returns first control command argument, empty if there are no arguments.
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+// listenControl starts control interface if control socket is configured.
+func (r *Reloader) listenControl(ctx context.Context) (*control.Server, error) {
+	if r.control == "" {
+		return nil, nil
+	}
+	s, err := control.Listen(r.control, map[string]control.Handler{
+		"status": func(ctx context.Context, args []string) (interface{}, error) {
+			return r.Status(ctx)
+		},
+		"apply": func(ctx context.Context, args []string) (interface{}, error) {
+			return nil, r.ApplyVersion(ctx, firstArg(args))
+		},
+		"rollback": func(ctx context.Context, args []string) (interface{}, error) {
+			return nil, r.Rollback(ctx, firstArg(args))
+		},
+		"restart": func(ctx context.Context, args []string) (interface{}, error) {
+			return nil, r.Restart(ctx)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	go s.Serve(ctx)
+	return s, nil
+}
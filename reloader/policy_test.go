@@ -0,0 +1,123 @@
+package reloader
+
+import (
+	"context"
+	"github.com/tumb1er/go-reloader/reloader/schedule"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseUpdatePolicy(t *testing.T) {
+	for _, name := range []string{"immediate", "window", "manual"} {
+		if p, err := ParseUpdatePolicy(name); err != nil || string(p) != name {
+			t.Errorf("%s: %s, %v", name, p, err)
+		}
+	}
+	if _, err := ParseUpdatePolicy("later"); err == nil {
+		t.Fatal("unknown policy is parsed")
+	}
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	r := newTestReloader()
+	for _, spec := range []string{"0 2 * * *", "30 23 * * 6"} {
+		w, err := schedule.NewWindow(spec, time.Hour, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.AddMaintenanceWindow(w)
+	}
+	// Saturday
+	day := time.Date(2020, 1, 18, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		at   time.Duration
+		open bool
+		next time.Duration
+	}{
+		{time.Hour, false, 2 * time.Hour},
+		{2*time.Hour + 30*time.Minute, true, 23*time.Hour + 30*time.Minute},
+		{3 * time.Hour, false, 23*time.Hour + 30*time.Minute},
+		// windows may cross midnight
+		{24*time.Hour + 15*time.Minute, true, 26 * time.Hour},
+	}
+	for _, tc := range testCases {
+		at := day.Add(tc.at)
+		if open := r.windowOpen(at); open != tc.open {
+			t.Errorf("%s: window open %v", at, open)
+		}
+		if next := r.nextWindow(at); !next.Equal(day.Add(tc.next)) {
+			t.Errorf("%s: next window at %s", at, next)
+		}
+	}
+	// without windows there is no next window
+	if next := newTestReloader().nextWindow(day); !next.IsZero() {
+		t.Fatalf("next window at %s", next)
+	}
+}
+
+func TestManualPolicy(t *testing.T) {
+	s := newSupervisor(t, "exec sleep 10", WithUpdatePolicy(PolicyManual))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Apply(ctx); err != ErrNotRunning {
+		t.Fatalf("error %v, expected %v", err, ErrNotRunning)
+	}
+	result := s.start(t, ctx)
+	staged := filepath.Join(s.staging, "child")
+	if err := ioutil.WriteFile(staged, []byte("#!/bin/sh\nexec sleep 20\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(staged, future, future); err != nil {
+		t.Fatal(err)
+	}
+	// update is held until apply command
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		st, err := s.Status(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(st.Pending) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("update is not pending")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := s.Apply(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// child is restarted with new binary
+	timeout := time.After(10 * time.Second)
+	for started := false; !started; {
+		select {
+		case e := <-s.events:
+			_, started = e.(ChildStarted)
+		case <-timeout:
+			t.Fatal("child is not restarted")
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "child"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "#!/bin/sh\nexec sleep 20\n" {
+		t.Fatalf("child is not switched: %q", data)
+	}
+	st, err := s.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Pending) != 0 {
+		t.Fatalf("pending updates %+v", st.Pending)
+	}
+	cancel()
+	if err := wait(t, result); err != context.Canceled {
+		t.Fatalf("error %v, expected %v", err, context.Canceled)
+	}
+}
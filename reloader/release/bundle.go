@@ -0,0 +1,298 @@
+package release
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BundleSuffixes lists supported bundle archive formats.
+var BundleSuffixes = []string{".tar.gz", ".tgz", ".tar.zst", ".zip"}
+
+// IsBundle checks whether path is a bundle archive.
+func IsBundle(path string) bool {
+	return bundleSuffix(path) != ""
+}
+
+// bundleSuffix returns archive suffix of a path, empty if path is not a bundle.
+func bundleSuffix(path string) string {
+	for _, suffix := range BundleSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// limits restrict unpacked bundle contents, so bundles unpacking to excessive size are refused before
+// filling the disk.
+type limits struct {
+	// maximum number of entries
+	entries int
+	// maximum size of a single file and of all files
+	entrySize int64
+	totalSize int64
+}
+
+// defaultLimits are bundle limits applied by Unpack.
+var defaultLimits = limits{entries: 1 << 16, entrySize: 2 << 30, totalSize: 8 << 30}
+
+// usage counts unpacked entries and bytes against limits.
+type usage struct {
+	limits
+	count int
+	size  int64
+}
+
+// entry accounts bundle entry, refusing it if entry count limit is exceeded.
+func (u *usage) entry() error {
+	u.count++
+	if u.count > u.entries {
+		return fmt.Errorf("bundle has more than %d entries", u.limits.entries)
+	}
+	return nil
+}
+
+// remaining returns number of bytes file may have, refusing file if it's declared size exceeds limits.
+func (u *usage) remaining(name string, size int64) (int64, error) {
+	remaining := u.totalSize - u.size
+	if u.entrySize < remaining {
+		remaining = u.entrySize
+	}
+	if size > remaining {
+		return 0, u.exceeded(name)
+	}
+	return remaining, nil
+}
+
+// exceeded returns error for a file exceeding size limits.
+func (u *usage) exceeded(name string) error {
+	if u.totalSize-u.size < u.entrySize {
+		return fmt.Errorf("bundle is larger than %d bytes unpacked: %s", u.totalSize, name)
+	}
+	return fmt.Errorf("bundle entry is larger than %d bytes: %s", u.entrySize, name)
+}
+
+// Unpack extracts bundle archive into dir. Bundles exceeding entry count or unpacked size limits are refused.
+func Unpack(archive, dir string) error {
+	return unpack(archive, dir, defaultLimits)
+}
+
+// unpack extracts bundle archive into dir within limits.
+func unpack(archive, dir string, l limits) error {
+	u := &usage{limits: l}
+	switch bundleSuffix(archive) {
+	case ".zip":
+		return unpackZip(archive, dir, u)
+	case ".tar.gz", ".tgz":
+		f, err := os.Open(archive)
+		if err != nil {
+			return err
+		}
+		defer executable.CloseFile(f)
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer executable.CloseFile(gz)
+		return unpackTar(gz, dir, u)
+	case ".tar.zst":
+		f, err := os.Open(archive)
+		if err != nil {
+			return err
+		}
+		defer executable.CloseFile(f)
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return unpackTar(zr, dir, u)
+	}
+	return errors.New("unsupported bundle format: " + archive)
+}
+
+// Validate checks that unpacked bundle contains an executable binary with given name at top level.
+func Validate(dir, name string) error {
+	fi, err := os.Lstat(filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("bundle doesn't contain %s", name)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("bundle %s is not a regular file", name)
+	}
+	if fi.Size() == 0 {
+		return fmt.Errorf("bundle %s is empty", name)
+	}
+	return os.Chmod(filepath.Join(dir, name), fi.Mode().Perm()|0111)
+}
+
+// target returns entry path inside dir, rejecting absolute paths and paths escaping dir.
+func target(dir, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || strings.HasPrefix(name, `\`) {
+		return "", fmt.Errorf("bundle entry has absolute path: %s", name)
+	}
+	path := filepath.Join(dir, name)
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("bundle entry is outside of bundle: %s", name)
+	}
+	return path, nil
+}
+
+// checkParents refuses entry path if any of it's parent directories inside dir is a symlink, so entries can't
+// be written through symlinks pointing outside of dir.
+func checkParents(dir, path string) error {
+	for p := filepath.Dir(path); p != dir && strings.HasPrefix(p, dir+string(filepath.Separator)); p = filepath.Dir(p) {
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			rel, _ := filepath.Rel(dir, path)
+			return fmt.Errorf("bundle entry is inside of symlink: %s", rel)
+		}
+	}
+	return nil
+}
+
+// entryPath returns entry path inside dir, see target and checkParents.
+func entryPath(dir, name string) (string, error) {
+	path, err := target(dir, name)
+	if err != nil {
+		return "", err
+	}
+	return path, checkParents(dir, path)
+}
+
+// unpackTar extracts regular files, directories and relative symlinks from tar stream.
+func unpackTar(r io.Reader, dir string, u *usage) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := u.entry(); err != nil {
+			return err
+		}
+		path, err := entryPath(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := mkdir(path); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeFile(path, h.Name, tr, os.FileMode(h.Mode).Perm(), h.Size, u); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(h.Linkname) {
+				return fmt.Errorf("bundle symlink has absolute target: %s", h.Name)
+			}
+			if _, err := target(dir, filepath.Join(filepath.Dir(h.Name), h.Linkname)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(h.Linkname, path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported bundle entry type %c: %s", h.Typeflag, h.Name)
+		}
+	}
+}
+
+// unpackZip extracts files and directories from zip archive.
+func unpackZip(archive, dir string, u *usage) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer executable.CloseFile(zr)
+	for _, f := range zr.File {
+		if err := u.entry(); err != nil {
+			return err
+		}
+		path, err := entryPath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := mkdir(path); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			return fmt.Errorf("unsupported bundle entry: %s", f.Name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(path, f.Name, r, f.Mode().Perm(), int64(f.UncompressedSize64), u)
+		executable.CloseFile(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mkdir creates directory with parents, refusing to reuse existing symlink as a directory.
+func mkdir(path string) error {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("bundle directory is a symlink: %s", path)
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// writeFile creates file with parent directories and copies content of declared size from r within usage
+// limits. Existing files and symlinks are not overwritten.
+func writeFile(path, name string, r io.Reader, mode os.FileMode, size int64, u *usage) error {
+	remaining, err := u.remaining(name, size)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	defer executable.CloseFile(w)
+	// declared size may be forged, so content is limited too
+	n, err := io.Copy(w, io.LimitReader(r, remaining+1))
+	if err != nil {
+		return err
+	}
+	if n > remaining {
+		return u.exceeded(name)
+	}
+	u.size += n
+	return nil
+}
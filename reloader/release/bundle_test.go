@@ -0,0 +1,268 @@
+package release
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entry is a bundle archive entry, directory if name ends with slash.
+type entry struct {
+	name string
+	body string
+	// symlink target
+	link string
+}
+
+// writeTar writes entries to tar archive at path compressed as path suffix requires.
+func writeTar(t *testing.T, path string, entries []entry) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	var w io.WriteCloser
+	switch bundleSuffix(path) {
+	case ".tar.zst":
+		if w, err = zstd.NewWriter(f); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		w = gzip.NewWriter(f)
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case e.link != "":
+			h.Typeflag, h.Linkname, h.Mode = tar.TypeSymlink, e.link, 0777
+		case e.name[len(e.name)-1] == '/':
+			h.Typeflag, h.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeZip writes entries without symlinks to zip archive at path.
+func writeZip(t *testing.T, path string, entries []entry) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	valid := []entry{
+		{name: "app", body: "binary"},
+		{name: "conf/"},
+		{name: "conf/app.yml", body: "key: value"},
+		{name: "static/css/app.css", body: "body {}"},
+		{name: "app.yml", link: "conf/app.yml"},
+	}
+	testCases := []struct {
+		name    string
+		archive string
+		entries []entry
+		err     bool
+	}{
+		{"tar.gz", "app.tar.gz", valid, false},
+		{"tgz", "app.tgz", valid, false},
+		{"tar.zst", "app.tar.zst", valid, false},
+		{"zip", "app.zip", valid[:4], false},
+		{"relative symlink to parent", "app.tar.gz", []entry{{name: "a/b", link: ".."}}, false},
+		{"parent path", "app.tar.gz", []entry{{name: "../evil", body: "x"}}, true},
+		{"nested parent path", "app.tar.gz", []entry{{name: "a/../../evil", body: "x"}}, true},
+		{"absolute path", "app.tar.gz", []entry{{name: "/tmp/evil", body: "x"}}, true},
+		{"zip parent path", "app.zip", []entry{{name: "../evil", body: "x"}}, true},
+		{"symlink outside", "app.tar.gz", []entry{{name: "evil", link: "../outside"}}, true},
+		{"absolute symlink", "app.tar.gz", []entry{{name: "evil", link: "/etc"}}, true},
+		{"file through symlink", "app.tar.gz", []entry{
+			{name: "sub/"},
+			{name: "lnk", link: "sub"},
+			{name: "lnk/evil", body: "x"},
+		}, true},
+		{"symlink chain", "app.tar.gz", []entry{
+			{name: "a/b", link: ".."},
+			{name: "a/b/c", link: ".."},
+			{name: "a/b/c/evil", body: "x"},
+		}, true},
+		{"directory over symlink", "app.tar.gz", []entry{
+			{name: "sub/"},
+			{name: "lnk", link: "sub"},
+			{name: "lnk/"},
+		}, true},
+		{"file over symlink", "app.tar.gz", []entry{
+			{name: "app", body: "binary"},
+			{name: "lnk", link: "app"},
+			{name: "lnk", body: "x"},
+		}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "bundle")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = os.RemoveAll(root) }()
+			archive := filepath.Join(root, tc.archive)
+			if bundleSuffix(archive) == ".zip" {
+				writeZip(t, archive, tc.entries)
+			} else {
+				writeTar(t, archive, tc.entries)
+			}
+			dir := filepath.Join(root, "release")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			err = Unpack(archive, dir)
+			// nothing is written outside of release directory
+			if files, _ := ioutil.ReadDir(root); len(files) != 2 {
+				t.Fatalf("bundle entries are written outside of release directory: %v", files)
+			}
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range tc.entries {
+				if e.body == "" {
+					continue
+				}
+				if data, err := ioutil.ReadFile(filepath.Join(dir, e.name)); err != nil || string(data) != e.body {
+					t.Errorf("%s: %q, %v", e.name, data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestUnpackLimits(t *testing.T) {
+	l := limits{entries: 3, entrySize: 10, totalSize: 16}
+	testCases := []struct {
+		name    string
+		archive string
+		entries []entry
+		err     string
+	}{
+		{"within limits", "app.tar.gz", []entry{{name: "app", body: "0123456789"}, {name: "conf/"},
+			{name: "app.yml", body: "012345"}}, ""},
+		{"zip within limits", "app.zip", []entry{{name: "app", body: "0123456789"}, {name: "app.yml", body: "012345"}}, ""},
+		{"too many entries", "app.tar.gz", []entry{{name: "a/"}, {name: "b/"}, {name: "c/"}, {name: "d/"}},
+			"bundle has more than 3 entries"},
+		{"zip too many entries", "app.zip", []entry{{name: "a"}, {name: "b"}, {name: "c"}, {name: "d"}},
+			"bundle has more than 3 entries"},
+		{"large entry", "app.tar.zst", []entry{{name: "app", body: "0123456789a"}},
+			"bundle entry is larger than 10 bytes: app"},
+		{"zip large entry", "app.zip", []entry{{name: "app", body: "0123456789a"}},
+			"bundle entry is larger than 10 bytes: app"},
+		{"large bundle", "app.tar.gz", []entry{{name: "app", body: "0123456789"}, {name: "app.yml", body: "0123456"}},
+			"bundle is larger than 16 bytes unpacked: app.yml"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "bundle")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = os.RemoveAll(root) }()
+			archive := filepath.Join(root, tc.archive)
+			if bundleSuffix(archive) == ".zip" {
+				writeZip(t, archive, tc.entries)
+			} else {
+				writeTar(t, archive, tc.entries)
+			}
+			err = unpack(archive, filepath.Join(root, "release"), l)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("error %v, expected %s", err, tc.err)
+			}
+		})
+	}
+}
+
+// TestWriteFileLimit checks that file content is limited regardless of declared size.
+func TestWriteFileLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	u := &usage{limits: limits{entries: 1, entrySize: 10, totalSize: 10}}
+	err = writeFile(filepath.Join(dir, "app"), "app", strings.NewReader("0123456789a"), 0644, 1, u)
+	if err == nil || err.Error() != "bundle entry is larger than 10 bytes: app" {
+		t.Fatalf("error %v", err)
+	}
+}
+
+func TestUnsupportedBundle(t *testing.T) {
+	if err := Unpack("app.rar", "release"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if err := Validate(dir, "app"); err == nil {
+		t.Fatal("expected error for missing binary")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "app"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(dir, "app"); err == nil {
+		t.Fatal("expected error for empty binary")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "app"), []byte("binary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(dir, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "app")); err != nil || fi.Mode()&0111 != 0111 {
+		t.Fatalf("binary is not executable: %v, %v", fi.Mode(), err)
+	}
+}
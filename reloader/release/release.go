@@ -0,0 +1,256 @@
+package release
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// directory keeping all releases
+	releasesDir = "releases"
+	// symlink pointing to active release
+	currentLink = "current"
+	// file in releases directory listing release ids in installation order
+	indexFile = ".index"
+)
+
+// ErrNoCurrent is returned when no release is activated yet.
+var ErrNoCurrent = errors.New("no current release")
+
+// Releases manages versioned release directories releases/<id> and a current symlink pointing to active one.
+type Releases struct {
+	root string
+}
+
+// Root returns releases root directory.
+func (r Releases) Root() string {
+	return r.root
+}
+
+// Dir returns release directory path.
+func (r Releases) Dir(id string) string {
+	return filepath.Join(r.root, releasesDir, id)
+}
+
+// CurrentDir returns path to current symlink.
+func (r Releases) CurrentDir() string {
+	return filepath.Join(r.root, currentLink)
+}
+
+// Current returns active release id.
+func (r Releases) Current() (string, error) {
+	target, err := os.Readlink(r.CurrentDir())
+	if os.IsNotExist(err) {
+		return "", ErrNoCurrent
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
+
+// Exists checks whether release is installed.
+func (r Releases) Exists(id string) bool {
+	fi, err := os.Stat(r.Dir(id))
+	return err == nil && fi.IsDir()
+}
+
+// Install creates release directory filled by populate. Release is created in temporary directory
+// and renamed when populate succeeds, so incomplete releases are never visible.
+func (r Releases) Install(id string, populate func(dir string) error) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+	base := filepath.Join(r.root, releasesDir)
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(base, "."+id+".tmp")
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		return err
+	}
+	if err := populate(tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	dst := r.Dir(id)
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	return r.record(id)
+}
+
+// indexPath returns path to installation order index.
+func (r Releases) indexPath() string {
+	return filepath.Join(r.root, releasesDir, indexFile)
+}
+
+// readIndex returns release ids in installation order, empty if nothing is recorded yet.
+func (r Releases) readIndex() ([]string, error) {
+	data, err := ioutil.ReadFile(r.indexPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// record moves release id to the end of installation order, forgetting removed releases.
+// Index is replaced atomically.
+func (r Releases) record(id string) error {
+	ids, err := r.readIndex()
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, i := range ids {
+		if i != id && checkID(i) == nil && r.Exists(i) {
+			b.WriteString(i + "\n")
+		}
+	}
+	b.WriteString(id + "\n")
+	tmp := r.indexPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.indexPath())
+}
+
+// Activate atomically points current symlink to a release.
+func (r Releases) Activate(id string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+	if !r.Exists(id) {
+		return errors.New("release not found: " + id)
+	}
+	tmp := filepath.Join(r.root, "."+currentLink+".tmp")
+	_ = os.Remove(tmp)
+	if err := os.Symlink(filepath.Join(releasesDir, id), tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, r.CurrentDir()); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Info describes an installed release.
+type Info struct {
+	ID        string    `json:"id"`
+	Installed time.Time `json:"installed"`
+	Current   bool      `json:"current"`
+}
+
+// List returns installed releases in installation order. Releases installed before installation order was
+// recorded come first, ordered by directory modification time.
+func (r Releases) List() ([]Info, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(r.root, releasesDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	current, err := r.Current()
+	if err != nil && err != ErrNoCurrent {
+		return nil, err
+	}
+	ids, err := r.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	// position in installation order, 0 if not recorded
+	seq := make(map[string]int, len(ids))
+	for i, id := range ids {
+		seq[id] = i + 1
+	}
+	var result []Info
+	for _, fi := range entries {
+		if !fi.IsDir() || checkID(fi.Name()) != nil {
+			continue
+		}
+		result = append(result, Info{ID: fi.Name(), Installed: fi.ModTime(), Current: fi.Name() == current})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if si, sj := seq[result[i].ID], seq[result[j].ID]; si != sj {
+			return si < sj
+		}
+		return result[i].Installed.Before(result[j].Installed)
+	})
+	return result, nil
+}
+
+// Previous returns a release installed before current one.
+func (r Releases) Previous() (string, error) {
+	list, err := r.List()
+	if err != nil {
+		return "", err
+	}
+	for i, info := range list {
+		if info.Current {
+			if i == 0 {
+				return "", errors.New("no previous release")
+			}
+			return list[i-1].ID, nil
+		}
+	}
+	return "", ErrNoCurrent
+}
+
+// Prune removes oldest releases keeping last keep ones, current release is never removed.
+func (r Releases) Prune(keep int) ([]string, error) {
+	list, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for i := 0; i < len(list)-keep; i++ {
+		if list[i].Current {
+			continue
+		}
+		if err := os.RemoveAll(r.Dir(list[i].ID)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, list[i].ID)
+	}
+	return removed, nil
+}
+
+// checkID prevents release ids escaping releases directory.
+func checkID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return errors.New("invalid release id: " + id)
+	}
+	return nil
+}
+
+// ID returns release id for an artifact version, or for it's checksum if version is unknown.
+func ID(version, checksum string) string {
+	if version != "" && checkID(version) == nil {
+		return version
+	}
+	if len(checksum) > 16 {
+		return checksum[:16]
+	}
+	return checksum
+}
+
+// New returns releases manager for a root directory.
+func New(root string) *Releases {
+	return &Releases{root: root}
+}
@@ -0,0 +1,162 @@
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newReleases returns releases manager in a temporary directory with releases installed in order.
+func newReleases(t *testing.T, ids ...string) *Releases {
+	root, err := ioutil.TempDir("", "releases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+	r := New(root)
+	for _, id := range ids {
+		install(t, r, id)
+	}
+	return r
+}
+
+// install installs release with app binary.
+func install(t *testing.T, r *Releases, id string) {
+	if err := r.Install(id, func(dir string) error {
+		return ioutil.WriteFile(filepath.Join(dir, "app"), []byte(id), 0755)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ids returns ids of listed releases, current one is marked with asterisk.
+func ids(t *testing.T, r *Releases) string {
+	list, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make([]string, len(list))
+	for i, info := range list {
+		result[i] = info.ID
+		if info.Current {
+			result[i] = "*" + info.ID
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+func TestList(t *testing.T) {
+	r := newReleases(t, "1.0.0", "1.1.0", "1.2.0")
+	// directory modification time doesn't change installation order
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(r.Dir("1.2.0"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Activate("1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if list := ids(t, r); list != "1.0.0 *1.1.0 1.2.0" {
+		t.Fatalf("releases %s", list)
+	}
+	// reinstalled release is the last one
+	install(t, r, "1.0.0")
+	if list := ids(t, r); list != "*1.1.0 1.2.0 1.0.0" {
+		t.Fatalf("releases %s", list)
+	}
+	// releases missing in index come first in modification time order
+	for _, id := range []string{"0.2.0", "0.1.0"} {
+		if err := os.Mkdir(r.Dir(id), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(r.Dir(id), old, old); err != nil {
+			t.Fatal(err)
+		}
+		old = old.Add(-time.Hour)
+	}
+	if list := ids(t, r); list != "0.1.0 0.2.0 *1.1.0 1.2.0 1.0.0" {
+		t.Fatalf("releases %s", list)
+	}
+}
+
+func TestListEmpty(t *testing.T) {
+	r := newReleases(t)
+	if list, err := r.List(); err != nil || len(list) != 0 {
+		t.Fatalf("releases %v, %v", list, err)
+	}
+	if _, err := r.Current(); err != ErrNoCurrent {
+		t.Fatalf("error %v, expected %v", err, ErrNoCurrent)
+	}
+	if _, err := r.Previous(); err != ErrNoCurrent {
+		t.Fatalf("error %v, expected %v", err, ErrNoCurrent)
+	}
+}
+
+func TestPrevious(t *testing.T) {
+	r := newReleases(t, "1.0.0", "1.1.0", "1.2.0")
+	testCases := []struct {
+		current  string
+		previous string
+	}{
+		{"1.2.0", "1.1.0"},
+		{"1.1.0", "1.0.0"},
+		{"1.0.0", ""},
+	}
+	for _, tc := range testCases {
+		if err := r.Activate(tc.current); err != nil {
+			t.Fatal(err)
+		}
+		previous, err := r.Previous()
+		if tc.previous == "" {
+			if err == nil {
+				t.Fatalf("%s: previous release %s", tc.current, previous)
+			}
+			continue
+		}
+		if err != nil || previous != tc.previous {
+			t.Fatalf("%s: previous release %s, %v", tc.current, previous, err)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	r := newReleases(t, "1.0.0", "1.1.0", "1.2.0", "1.3.0")
+	if err := r.Activate("1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := r.Prune(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// current release is kept
+	if strings.Join(removed, " ") != "1.1.0" {
+		t.Fatalf("removed %v", removed)
+	}
+	if list := ids(t, r); list != "*1.0.0 1.2.0 1.3.0" {
+		t.Fatalf("releases %s", list)
+	}
+	// removed releases are forgotten on next install
+	install(t, r, "1.4.0")
+	data, err := ioutil.ReadFile(r.indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1.0.0\n1.2.0\n1.3.0\n1.4.0\n" {
+		t.Fatalf("index %q", data)
+	}
+}
+
+func TestCheckID(t *testing.T) {
+	for _, id := range []string{"1.2.0", "fb42e95e0c1d2a3b", "v1"} {
+		if err := checkID(id); err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+	}
+	for _, id := range []string{"", ".", "..", "a/b", `a\b`, indexFile, ".1.2.0.tmp"} {
+		if err := checkID(id); err == nil {
+			t.Errorf("%s: expected error", id)
+		}
+	}
+}
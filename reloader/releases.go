@@ -0,0 +1,173 @@
+package reloader
+
+import (
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/audit"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/release"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"os"
+	"path/filepath"
+)
+
+// releaseID returns release id for an update candidate.
+func releaseID(c source.Candidate) string {
+	return release.ID(c.Version, c.Checksum)
+}
+
+// isInstalled checks whether update candidate is already installed as a release.
+// Installed releases are never installed again automatically, so manual rollbacks are kept.
+func (r *Reloader) isInstalled(c source.Candidate) bool {
+	return c.Checksum != "" && r.releases.Exists(releaseID(c))
+}
+
+// installRelease installs new binary or unpacks bundle archive to a new release directory and returns it's id.
+// Installed reports whether release is installed now, existing release is not installed again.
+func (r *Reloader) installRelease(path string, c source.Candidate) (id string, installed bool, err error) {
+	if c.Checksum == "" {
+		cmd, err := executable.NewExecutable(path)
+		if err != nil {
+			return "", false, err
+		}
+		c.Checksum = cmd.Checksum()
+	}
+	id = releaseID(c)
+	if r.releases.Exists(id) {
+		return id, false, nil
+	}
+	name := filepath.Base(r.child)
+	r.logEvent("install", "installing release %s from %s", id, path)
+	if err := r.releases.Install(id, func(dir string) error {
+		if !release.IsBundle(path) {
+			if err := executable.CopyFile(path, filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		} else if err := release.Unpack(path, dir); err != nil {
+			return err
+		}
+		if err := release.Validate(dir, name); err != nil {
+			return err
+		}
+		if c.Version != "" {
+			if err := executable.WriteVersion(filepath.Join(dir, name), c.Version); err != nil {
+				return err
+			}
+		}
+		if release.IsBundle(path) {
+			// plain binaries are validated before install
+			if err := r.validateBinary(r.cmd, filepath.Join(dir, name)); err != nil {
+				return fmt.Errorf("bundle validation: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// activateRelease makes installed release current and prunes old releases.
+func (r *Reloader) activateRelease(id string) error {
+	r.logEvent("activate", "activating release %s", id)
+	if err := r.releases.Activate(id); err != nil {
+		return err
+	}
+	if r.keepReleases > 0 {
+		removed, err := r.releases.Prune(r.keepReleases)
+		for _, id := range removed {
+			r.logger.Printf("removed release %s", id)
+		}
+		if err != nil {
+			r.logger.Printf("prune releases error: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// releaseBinary returns child binary path in installed release.
+func (r *Reloader) releaseBinary(id string) string {
+	return filepath.Join(r.releases.Dir(id), filepath.Base(r.child))
+}
+
+// releaseActivated handles release id activated by activate command while child is running and reports whether
+// child must be restarted. Activation is approved by before-switch hooks and recorded in audit log as a switch or
+// rollback, then it fires after-switch or rollback hooks. Vetoed or not recorded release is deactivated.
+func (r *Reloader) releaseActivated(id string) bool {
+	cmd, err := executable.NewExecutable(r.child)
+	if err != nil {
+		r.logger.Printf("release %s error: %s", id, err.Error())
+		return false
+	}
+	if err := cmd.ProbeVersion(r.versionArg); err != nil {
+		r.logger.Printf("release %s version probe: %s", id, err.Error())
+	}
+	c := source.Candidate{
+		Name:     cmd.String(),
+		Location: r.releases.Dir(id),
+		Checksum: cmd.Checksum(),
+		Version:  cmd.Version(),
+		Build:    cmd.BuildInfo(),
+		Selected: true,
+	}
+	// child keeps running current release if activation is vetoed or can't be recorded
+	reactivate := func() bool {
+		if r.release != "" {
+			r.logEvent("activate", "reactivating release %s", r.release)
+			if err := r.releases.Activate(r.release); err != nil {
+				r.logger.Printf("activate release error: %s", err.Error())
+			}
+		}
+		return false
+	}
+	if !r.approve(r.cmd, c) {
+		return reactivate()
+	}
+	r.approved = ""
+	action := switchAction(r.cmd.Version(), cmd.Version())
+	if err := r.recordAudit(action, r.cmd, cmd.Checksum(), cmd.Version(), "release "+id); err != nil {
+		r.logger.Printf("release %s activation refused: %s", id, err.Error())
+		return reactivate()
+	}
+	r.logEvent("activate", "release %s activated, restarting child", id)
+	r.recordUpdate("activate", r.cmd, cmd.Checksum(), cmd.Version())
+	r.emit(Switched{Timestamp: now(), Path: r.cmd.Path(), From: r.cmd.Checksum(), To: cmd.Checksum(),
+		Version: cmd.Version(), Build: cmd.BuildInfo()})
+	if action == audit.Rollback {
+		_ = r.fireHooks(OnRollback, eventData(r.cmd))
+	} else {
+		_ = r.fireHooks(OnAfterSwitch, eventData(r.cmd))
+	}
+	return true
+}
+
+// currentRelease returns id of current release, empty if releases layout is disabled or not initialized.
+func (r *Reloader) currentRelease() string {
+	if r.releases == nil {
+		return ""
+	}
+	id, _ := r.releases.Current()
+	return id
+}
+
+// bootstrapRelease installs first release from staging directory if child executable is missing.
+func (r *Reloader) bootstrapRelease() error {
+	if r.releases == nil {
+		return nil
+	}
+	if _, err := os.Stat(r.child); !os.IsNotExist(err) {
+		return err
+	}
+	name := filepath.Base(r.child)
+	for _, suffix := range append([]string{""}, release.BundleSuffixes...) {
+		path := filepath.Join(r.staging, name+suffix)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		id, _, err := r.installRelease(path, source.Candidate{Name: name, Location: path})
+		if err != nil {
+			return err
+		}
+		return r.activateRelease(id)
+	}
+	return nil
+}
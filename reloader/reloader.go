@@ -3,11 +3,23 @@ package reloader
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/audit"
 	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/logging"
+	"github.com/tumb1er/go-reloader/reloader/release"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"github.com/tumb1er/go-reloader/reloader/state"
+	"github.com/tumb1er/go-reloader/reloader/version"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -19,48 +31,150 @@ type Reloader struct {
 	// link to child executable binary
 	cmd          *executable.Executable
 	stopReloader context.CancelFunc
+	// Stop is called, Run returns immediately
+	stopped bool
+	// closed when Run returns
+	done chan struct{}
+	// update approved by before-switch hooks, see approvalKey
+	approved string
+	// release child process is started from
+	release string
+	// updates held by update policy by executable name
+	pending map[string]Pending
+	// last refused update by executable name
+	refused map[string]string
+	// updates failed validation by candidate checksum and location
+	invalid map[string]string
+	// control commands executed by Run loop
+	commands chan command
+	// staging directory source, kept between checks to track staged files readiness
+	dir *source.Dir
+	// reloader runs as a daemon or service restarted by updater
+	daemon bool
+	// stops terminating running child when reloader exits
+	detach func()
+	// reloader state kept across restarts, nil if disabled
+	store *state.Store
+	// audit log, nil if disabled
+	auditLog *audit.Log
+	// child metrics file observer, nil if metrics file is not configured or reloader has not run yet
+	metrics *metricsFile
+	// what initiated current update or restart, recorded in audit log
+	actor string
+	// child version requested by apply command
+	target string
+	// last child process exit status, nil if child has not exited yet
+	lastExit *executable.ExitStatus
+	// connection to previous reloader until child is started after self update
+	handshake net.Conn
+	// hooks fired in background, waited for when Run returns
+	backgroundHooks sync.WaitGroup
+
+	mu sync.Mutex
+	// lifecycle events observers
+	observers []Observer
+	// channel returned by Events
+	events channelObserver
 }
 
 // startChild starts new child process and returns a channel that is closed when
 // child process exits. When context is done, child process is terminated.
-func (r *Reloader) startChild(ctx context.Context) (<-chan int, context.CancelFunc, error) {
-	childContext, stopChild := context.WithCancel(ctx)
+func (r *Reloader) startChild(ctx context.Context) (<-chan executable.ExitStatus, context.CancelFunc, error) {
 	var err error
 	r.logger.Print("starting child")
 	// initializing child process
 	if r.cmd, err = executable.NewExecutable(r.child, r.args...); err != nil {
-		r.logger.Fatalf("child init failed %s", err.Error())
+		r.logger.Printf("child init failed %s", err.Error())
 		return nil, nil, err
 	}
 
 	if err := r.cmd.Start(r.stdout, r.stderr); err != nil {
-		r.logger.Fatalf("child start failed: %s", err.Error())
+		r.logger.Printf("child start failed: %s", err.Error())
 		return nil, nil, err
 	}
-	r.logger.Print("child started")
+	if err := r.cmd.ProbeVersion(r.versionArg); err != nil {
+		r.logger.Printf("child version probe: %s", err.Error())
+	}
+	r.logger.Printf("child started: %s", r.cmd.Describe())
+	r.release = r.currentRelease()
+	cmd := r.cmd
+	r.emit(ChildStarted{
+		Timestamp: now(),
+		PID:       cmd.Pid(),
+		Path:      cmd.Path(),
+		Checksum:  cmd.Checksum(),
+		Version:   cmd.Version(),
+		Build:     cmd.BuildInfo(),
+	})
+	_ = r.fireHooks(OnChildStarted, eventData(cmd))
+	ch, stopChild := r.watchChild(ctx)
+	return ch, stopChild, nil
+}
+
+// watchChild waits for running child process exit in background and returns a channel that receives exit status
+// and is closed when child process exits. When context is done, child process is terminated.
+func (r *Reloader) watchChild(ctx context.Context) (<-chan executable.ExitStatus, context.CancelFunc) {
+	childContext, stopChild := context.WithCancel(ctx)
+	cmd := r.cmd
+	r.setField("CHILD_PID", strconv.Itoa(cmd.Pid()))
+	r.setField("CHILD_VERSION", childVersion(cmd))
+	r.setField("CHILD_CHECKSUM", cmd.Checksum())
 
 	// start child process waiter
-	ch := make(chan int)
+	ch, exited := make(chan executable.ExitStatus, 1), make(chan struct{})
 	go func() {
 		defer close(ch)
+		defer close(exited)
 		r.logger.Print("waiting for child exit")
-		if exitCode, err := r.cmd.Wait(); err != nil {
-			r.logger.Fatalf("terminate wait: %e", err)
+		status, err := cmd.Wait()
+		if err != nil {
+			r.logger.Printf("terminate wait: %s", err.Error())
+			status = executable.ExitStatus{Code: -1, Unknown: true}
 		} else {
-			r.logger.Printf("child exited with exit code %d", exitCode)
+			r.logger.Printf("child exited: %s", status)
+			r.emit(ChildExited{Timestamp: now(), PID: cmd.Pid(), Code: status.Code, Signal: status.Signal, Status: status})
+			// slow hooks don't delay restart decision
+			r.fireHooksBackground(OnChildExited, exitData(cmd, status))
 		}
+		r.setField("CHILD_PID", "")
+		ch <- status
 	}()
 
 	// start context handler
+	detach, detached := make(chan struct{}), make(chan struct{})
+	r.detach = func() {
+		close(detach)
+		<-detached
+	}
 	go func() {
-		<-childContext.Done()
-		r.logger.Print("terminating child")
-		if err := r.cmd.Terminate(r.tree); err != nil {
-			r.logger.Fatalf("terminate child: %s", err.Error())
+		defer close(detached)
+		select {
+		case <-exited:
+			// child exited by itself
+			stopChild()
+		case <-detach:
+			// child is handed over to updated reloader and left running
+		case <-childContext.Done():
+			r.logger.Print("terminating child")
+			if err := cmd.Terminate(r.tree); err != nil {
+				r.logger.Printf("terminate child: %s", err.Error())
+			}
 		}
 	}()
 
-	return ch, stopChild, nil
+	return ch, stopChild
+}
+
+// initChild initializes child executable without starting it.
+func (r *Reloader) initChild() error {
+	var err error
+	if r.cmd, err = executable.NewExecutable(r.child, r.args...); err != nil {
+		return err
+	}
+	if err := r.cmd.ProbeVersion(r.versionArg); err != nil {
+		r.logger.Printf("child version probe: %s", err.Error())
+	}
+	return nil
 }
 
 func (r *Reloader) initSelf() error {
@@ -72,163 +186,903 @@ func (r *Reloader) initSelf() error {
 	if r.self, err = executable.NewExecutable(self); err != nil {
 		return err
 	}
+	if err := r.self.ProbeVersion(r.versionArg); err != nil {
+		r.logger.Printf("self version probe: %s", err.Error())
+	}
 	return nil
 }
 
+// Run starts child process and watches for updates until reloader is stopped or updated.
 func (r *Reloader) Run() error {
+	return r.RunContext(context.Background())
+}
+
+// RunContext starts child process and watches for updates until ctx is done, reloader is stopped or updated.
+// Child process is terminated and waited for before RunContext returns.
+// ErrUpdated is returned when reloader has handed over to it's updated version.
+// RunContext returns nil without starting child if reloader is stopped already.
+func (r *Reloader) RunContext(ctx context.Context) error {
+	defer r.closeEvents()
+	defer r.backgroundHooks.Wait()
+	if r.isStopped() {
+		return nil
+	}
 	r.logger.Printf("Running %s...", r.version)
 	if err := r.initSelf(); err != nil {
-		return err
+		return &Error{Op: "self init", Err: err}
+	}
+	r.logger.Printf("reloader binary: %s", r.self.Describe())
+	handover, err := readHandover()
+	if err != nil {
+		return &Error{Op: "handover", Err: err}
+	}
+	if err := r.confirmHandoff(); err != nil {
+		return &Error{Op: "self update handshake", Err: err}
+	}
+	// previous reloader resumes if child is not started
+	defer r.closeHandoff()
+	r.recordPid()
+	defer r.removePid()
+	if err := r.openState(); err != nil {
+		return &Error{Op: "state open", Err: err}
+	}
+	r.openAudit()
+	r.openMetrics()
+	if err := r.bootstrapRelease(); err != nil {
+		return &Error{Op: "release install", Err: err}
 	}
 
-	var reloaderContext context.Context
-	reloaderContext, r.stopReloader = context.WithCancel(context.Background())
-
-	interrupted := make(chan os.Signal, 1)
-	signal.Notify(interrupted, os.Interrupt)
+	reloaderContext, stopReloader := context.WithCancel(ctx)
+	defer stopReloader()
+	done := make(chan struct{})
+	defer close(done)
+	commands := make(chan command)
+	r.mu.Lock()
+	stopped := r.stopped
+	r.stopReloader = stopReloader
+	r.done = done
+	r.commands = commands
+	r.mu.Unlock()
+	if stopped {
+		// stopped while initializing
+		return nil
+	}
 
-	childExited, stopChild, err := r.startChild(reloaderContext)
+	server, err := r.listenControl(reloaderContext)
 	if err != nil {
-		r.logger.Fatalf("child start error")
+		return &Error{Op: "control listen", Err: err}
+	}
+	if server != nil {
+		defer func() {
+			// running commands are cancelled before waiting for them
+			stopReloader()
+			_ = server.Close()
+		}()
+	}
+	// closeControl frees control socket for updated reloader, commands are not waited for as Run loop is busy
+	closeControl := func() {
+		if server != nil {
+			_ = server.Stop()
+		}
+	}
+	// reopenControl records reloader pid and listens control socket again after failed self update
+	reopenControl := func() error {
+		// updated reloader may have replaced pid file
+		r.recordPid()
+		if server == nil {
+			return nil
+		}
+		s, err := r.listenControl(reloaderContext)
+		if err != nil {
+			return &Error{Op: "control listen", Err: err}
+		}
+		server = s
+		return nil
+	}
+
+	// nil channel blocks forever when signal handling is disabled
+	var interrupted, hangup chan os.Signal
+	if !r.noSignals {
+		interrupted = make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt)
+		defer signal.Stop(interrupted)
+		// SIGHUP restarts child, it is never sent on Windows
+		hangup = make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		defer signal.Stop(hangup)
+	}
+
+	var childExited <-chan executable.ExitStatus
+	// exit status of child exited by itself and not restarted
+	var childExit *executable.ExitStatus
+	var stopChild context.CancelFunc
+	if handover != nil {
+		if childExited, stopChild, err = r.adoptChild(reloaderContext, handover); err != nil {
+			return &Error{Op: "child adopt", Err: err}
+		}
+	} else if childExited, stopChild, err = r.startChild(reloaderContext); err != nil {
+		return &Error{Op: "child start", Err: err}
 	}
+	r.completeHandoff()
 
 	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
 
 	running := true
+	// another release is activated while child is running
+	activated := false
+	// child is stopped by restart command or signal
+	restarting := false
+	// child binary is switched back after child is stopped
+	var rollback *source.Candidate
+	// child is stopped to apply an update
+	applying := false
+	// reloader update handed over to updated reloader after current event is handled
+	var selfUpdate *source.Candidate
+	// checkUpdates checks child and self for updates and stops child if update is allowed by policy or forced.
+	// It reports whether any update is found and whether it is being applied.
+	checkUpdates := func(force bool) (found bool, applied bool) {
+		r.updateState(func(st *state.State) { st.LastCheck = time.Now() })
+		actor := actorTicker
+		if force {
+			actor = actorControl
+		}
+		for _, cmd := range []*executable.Executable{r.cmd, r.self} {
+			cmd := cmd
+			detected := false
+			r.checkExecutable(reloaderContext, cmd, func(c source.Candidate) {
+				detected = true
+				if !force {
+					if reason := r.holdReason(reloaderContext, cmd, c, time.Now()); reason != "" {
+						if r.hold(cmd, c, reason) {
+							// download and validate update in advance
+							r.prefetch(reloaderContext, cmd, c)
+						}
+						return
+					}
+				}
+				// updates are refused before child is stopped if they can't be recorded
+				if err := r.checkAudit(); err != nil {
+					r.logger.Printf("%s update refused: %s", cmd.String(), err.Error())
+					return
+				}
+				if cmd == r.cmd && !r.approve(cmd, c) {
+					return
+				}
+				if !r.prefetch(reloaderContext, cmd, c) {
+					// failed update is approved again if it is fixed
+					r.approved = ""
+					return
+				}
+				applied = true
+				r.actor = actor
+				if cmd == r.self && !r.daemon {
+					// child keeps running until updated reloader is ready
+					selfUpdate = &c
+					return
+				}
+				applying = true
+				stopChild()
+			})
+			if !detected {
+				delete(r.pending, cmd.String())
+			}
+			found = found || detected
+		}
+		return found, applied
+	}
 	for {
 		select {
 		case <-reloaderContext.Done():
+			if childExited != nil {
+				// child context is already cancelled, so wait for termination
+				<-childExited
+			}
 			r.logger.Print("exit")
-			return nil
+			if childExit != nil && r.exitCode && ctx.Err() == nil {
+				return &ChildExitError{Status: *childExit}
+			}
+			return ctx.Err()
 		case <-interrupted:
 			r.logger.Print("received interrupt signal")
 			running = false
 			stopChild()
-		case <-childExited:
+		case <-hangup:
+			r.logEvent("restart", "received hangup signal, restarting child")
+			r.actor = actorSignal
+			restarting = true
+			stopChild()
+		case status := <-childExited:
 			r.logger.Print("child exited")
+			// prevent multiple reads from closed channel
+			childExited = nil
+			r.lastExit = &status
+			// child is not stopped by reloader itself
+			crashed := running && !restarting && !applying && !activated && rollback == nil
+			r.updateState(func(st *state.State) {
+				st.LastExit = &status
+				if crashed && status.Failure() {
+					st.Crashes++
+				}
+			})
 			updated := false
-			// check child and raise updated flag if child binary updated
-			if err := r.checkExecutableError(r.cmd, func() error {
-				r.logger.Printf("switching %s", r.cmd.String())
-				if err := r.cmd.Switch(r.staging); err != nil {
-					r.logger.Fatalf("switch binary error: %s", err.Error())
+			if !applying && !restarting {
+				r.actor = actorExit
+			}
+			// roll back or check child and raise updated flag if child binary updated
+			if rollback != nil {
+				c := *rollback
+				rollback = nil
+				var e *Error
+				if err := r.switchBack(c); errors.As(err, &e) {
+					return err
+				}
+				updated = true
+			} else if err := r.checkExecutableError(reloaderContext, r.cmd, func(c source.Candidate) error {
+				if !applying {
+					if reason := r.holdReason(reloaderContext, r.cmd, c, time.Now()); reason != "" {
+						r.hold(r.cmd, c, reason)
+						return nil
+					}
+				}
+				// update changed after child is stopped is approved again
+				if !r.approve(r.cmd, c) {
+					return nil
+				}
+				r.approved = ""
+				path, err := r.updateSource().Fetch(reloaderContext, c)
+				if err != nil {
+					r.logger.Printf("fetch %s error: %s", c.Location, err.Error())
+					return nil
+				}
+				var e *Error
+				if err := r.switchChild(path, c); errors.As(err, &e) {
 					return err
 				}
+				// on failure current binary is left untouched, so child is restarted with it
 				updated = true
 				return nil
 			}); err != nil {
 				return err
 			}
+			r.target = ""
 
 			// check self and lower running flag if self binary updated
-			if err := r.checkExecutableError(r.self, func() error {
-				running = false
-				return r.startSelfUpdate()
+			if err := r.checkExecutableError(reloaderContext, r.self, func(c source.Candidate) error {
+				if !applying {
+					if reason := r.holdReason(reloaderContext, r.self, c, time.Now()); reason != "" {
+						r.hold(r.self, c, reason)
+						return nil
+					}
+				}
+				path, err := r.updateSource().Fetch(reloaderContext, c)
+				if err != nil {
+					r.logger.Printf("fetch %s error: %s", c.Location, err.Error())
+					return nil
+				}
+				if err := r.validate(r.self, path); err != nil {
+					r.reject(r.self, c, err)
+					return nil
+				}
+				if err := r.auditReplace(audit.SelfUpdate, r.self, path, c); err != nil {
+					r.logger.Printf("self update refused: %s", err.Error())
+					return nil
+				}
+				_ = r.fireHooks(OnSelfUpdate, updateData(r.self, c))
+				released := false
+				release := func() {
+					released = true
+					closeControl()
+				}
+				if err := r.startSelfUpdate(reloaderContext, c, path, release, false); err != nil {
+					r.reject(r.self, c, fmt.Errorf("self update failed: %w", err))
+					if released {
+						// child is started below as usual
+						return reopenControl()
+					}
+					return nil
+				}
+				return ErrUpdated
 			}); err != nil {
 				return err
 			}
 
-			if running && (r.restart || updated) {
+			applying = false
+			failed := crashed && status.Failure()
+			if running && (r.restart || r.restartOnFailure && failed || updated || activated || restarting) {
+				activated = false
+				r.updateState(func(st *state.State) { st.Restarts++ })
+				if restarting && !updated {
+					r.logAudit(audit.Restart, r.cmd, r.cmd.Checksum(), r.cmd.Version(), "")
+				}
+				restarting = false
 				if childExited, stopChild, err = r.startChild(reloaderContext); err != nil {
-					return err
+					return &Error{Op: "child start", Err: err}
 				}
 			} else {
 				r.logger.Print("terminating")
-				// prevent multiple reads from closed channel
-				childExited = make(chan int)
-				r.stopReloader()
+				if crashed && !status.Unknown {
+					childExit = &status
+				}
+				stopReloader()
 			}
 		case <-ticker.C:
-			// check child and stop it if updated
-			r.checkExecutable(r.cmd, stopChild)
-			// check self and stop reloader if updated
-			r.checkExecutable(r.self, stopChild)
+			if id := r.currentRelease(); childExited != nil && id != r.release {
+				r.actor = actorTicker
+				if r.releaseActivated(id) {
+					activated = true
+					stopChild()
+				}
+				continue
+			}
+			checkUpdates(false)
+		case cmd := <-commands:
+			switch cmd.name {
+			case "status":
+				cmd.reply <- r.status()
+			case "restart":
+				r.logEvent("restart", "restarting child on command")
+				r.actor = actorControl
+				restarting = true
+				stopChild()
+				cmd.reply <- nil
+			case "apply":
+				r.target = firstArg(cmd.args)
+				found, applied := checkUpdates(true)
+				if !applied {
+					r.target = ""
+				}
+				if !found && firstArg(cmd.args) != "" {
+					cmd.reply <- fmt.Errorf("version %s is not found or refused, see reloader log", firstArg(cmd.args))
+				} else if !found {
+					cmd.reply <- ErrNoPending
+				} else if !applied {
+					cmd.reply <- errors.New("update is not applied, see reloader log")
+				} else {
+					cmd.reply <- nil
+				}
+			case "rollback":
+				c, err := r.rollbackCandidate(firstArg(cmd.args))
+				if err == nil {
+					err = r.validateBinary(r.cmd, c.Location)
+				}
+				if err == nil {
+					err = r.checkAudit()
+				}
+				if err != nil {
+					cmd.reply <- err
+					break
+				}
+				r.actor = actorControl
+				if r.releases != nil {
+					// release is activated while child is running
+					if err := r.switchBack(c); err != nil {
+						cmd.reply <- err
+						break
+					}
+					r.release = r.currentRelease()
+					activated = true
+				} else {
+					rollback = &c
+					applying = true
+				}
+				stopChild()
+				cmd.reply <- nil
+			default:
+				cmd.reply <- fmt.Errorf("unknown command %q", cmd.name)
+			}
+		}
+		if selfUpdate != nil {
+			c := *selfUpdate
+			selfUpdate = nil
+			path, err := r.updateSource().Fetch(reloaderContext, c)
+			if err != nil {
+				r.logger.Printf("fetch %s error: %s", c.Location, err.Error())
+				continue
+			}
+			if err := r.auditReplace(audit.SelfUpdate, r.self, path, c); err != nil {
+				r.logger.Printf("self update refused: %s", err.Error())
+				continue
+			}
+			_ = r.fireHooks(OnSelfUpdate, updateData(r.self, c))
+			handover := r.handover && childExited != nil
+			released := false
+			release := func() {
+				released = true
+				closeControl()
+				stopChild()
+				if childExited != nil {
+					<-childExited
+				}
+			}
+			if handover {
+				release = func() {
+					released = true
+					closeControl()
+					// updated reloader reads child output from now on
+					r.detach()
+					r.cmd.ClosePipes()
+				}
+			}
+			if err := r.startSelfUpdate(reloaderContext, c, path, release, handover); err != nil {
+				r.reject(r.self, c, fmt.Errorf("self update failed: %w", err))
+				if !released {
+					continue
+				}
+				r.logger.Print("resuming after failed self update")
+				if err := reopenControl(); err != nil {
+					return err
+				}
+				if handover {
+					// child output pipes are closed already, so handed over child is restarted
+					if err := r.cmd.Terminate(r.tree); err != nil {
+						r.logger.Printf("terminate child: %s", err.Error())
+					}
+					<-childExited
+				}
+				if childExited, stopChild, err = r.startChild(reloaderContext); err != nil {
+					return &Error{Op: "child start", Err: err}
+				}
+				continue
+			}
+			return ErrUpdated
 		}
 	}
 }
 
+// Stop terminates child process and makes Run return without waiting.
+// Stop called before Run makes Run return immediately.
+func (r *Reloader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	if r.stopReloader != nil {
+		r.stopReloader()
+	}
+}
+
+// isStopped checks whether Stop is called.
+func (r *Reloader) isStopped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopped
+}
+
+// Shutdown stops reloader and waits for child process exit and Run return or ctx is done.
+func (r *Reloader) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	done := r.done
+	r.mu.Unlock()
+	r.Stop()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // checkExecutableError checks executable for update and runs callback if update is found
-func (r Reloader) checkExecutableError(cmd *executable.Executable, onUpdate func() error) error {
+func (r *Reloader) checkExecutableError(ctx context.Context, cmd *executable.Executable, onUpdate func(c source.Candidate) error) error {
 	what := cmd.String()
-	r.logger.Printf("checking %s", what)
-	if latest, err := cmd.Latest(r.staging); err != nil {
-		r.logger.Fatalf("%s check error: %s", what, err.Error())
+	r.logger.Printf("checking %s", cmd.Describe())
+	c, err := r.updateSource().Check(ctx, cmd)
+	if err == source.ErrNoUpdate {
+		return nil
+	}
+	if errors.Is(err, source.ErrNotReady) {
+		r.logger.Printf("%s check: %s", what, err.Error())
+		return nil
+	}
+	if err != nil {
+		// update source may not contain an update yet, so check errors are not fatal
+		r.logger.Printf("%s check error: %s", what, err.Error())
+		return nil
+	}
+	if reason, ignore := r.screen(cmd, c); ignore {
+		if reason != "" {
+			r.logger.Printf("%s %s, ignoring %s", what, reason, c.Location)
+		}
+		return nil
+	} else if reason != "" {
+		r.refuse(cmd, c, reason)
+		return nil
+	}
+	if !r.isPending(cmd, c) {
+		r.logEvent("update-detected", "%s updated to %s", what, describeUpdate(c.Location, c))
+		r.emit(UpdateDetected{Timestamp: now(), Path: c.Location, Checksum: c.Checksum, Version: c.Version, Build: c.Build})
+		_ = r.fireHooks(OnUpdateDetected, updateData(cmd, c))
+	}
+	return onUpdate(c)
+}
+
+// screen checks update candidate against bad builds, version pin, downgrades and installed releases.
+// It returns why update is refused, or ignore if update is already installed or not supported, with optional reason.
+func (r *Reloader) screen(cmd *executable.Executable, c source.Candidate) (reason string, ignore bool) {
+	what := cmd.String()
+	// version requested by apply command overrides pin, version ordering and rollbacks
+	requested := cmd == r.cmd && r.target != ""
+	if reason, ok := r.invalid[invalidKey(c)]; ok {
+		return reason, false
+	}
+	if reason, ok := r.invalid[c.Checksum]; ok && !requested {
+		return reason, false
+	}
+	if requested && version.Compare(c.Version, r.target) != 0 {
+		return fmt.Sprintf("version %s is requested", r.target), false
+	}
+	if cmd == r.cmd && !requested && r.pin != "" && version.Compare(c.Version, r.pin) != 0 {
+		return fmt.Sprintf("%s is pinned to %s", what, r.pin), false
+	}
+	if !c.Selected && !requested && c.Version != "" && cmd.Version() != "" && !r.allowDowngrade {
+		// explicitly selected artifacts may roll back, other updates must not be older than current binary
+		if version.Compare(c.Version, cmd.Version()) < 0 {
+			return fmt.Sprintf("%s %s is newer", what, cmd.Version()), false
+		}
+	}
+	if r.releases != nil && cmd == r.cmd {
+		// selected releases are activated again when switching channels or pins
+		if r.isInstalled(c) && !((c.Selected || requested) && releaseID(c) != r.currentRelease()) {
+			return "", true
+		}
+	} else if release.IsBundle(c.Location) {
+		return "bundle updates require releases layout", true
+	}
+	return "", false
+}
+
+// prefetch fetches and validates an update before child process is stopped and reports whether it succeeded.
+func (r *Reloader) prefetch(ctx context.Context, cmd *executable.Executable, c source.Candidate) bool {
+	path, err := r.updateSource().Fetch(ctx, c)
+	if err != nil {
+		r.logger.Printf("fetch %s error: %s", c.Location, err.Error())
+		return false
+	}
+	if err := r.validate(cmd, path); err != nil {
+		r.reject(cmd, c, err)
+		return false
+	}
+	return true
+}
+
+// updateSource returns configured update source or staging directory source.
+func (r *Reloader) updateSource() source.UpdateSource {
+	s := r.source
+	if s == nil {
+		if r.dir == nil || r.dir.Path() != r.staging {
+			r.dir = source.NewDir(r.staging)
+		}
+		r.dir.SetVersionArg(r.versionArg)
+		r.dir.SetReadyMarker(r.readyMarker)
+		s = r.dir
+	}
+	if sel, ok := s.(source.Selective); ok {
+		sel.SetSelector(r.selector())
+	}
+	return s
+}
+
+// selector returns manifest artifacts selector for configured channel and child version pin.
+func (r *Reloader) selector() source.Selector {
+	sel := source.Selector{Channel: r.channel}
+	pin := r.pin
+	if r.target != "" {
+		pin = r.target
+	}
+	if pin != "" {
+		sel.Pins = map[string]string{filepath.Base(r.child): pin}
+	}
+	return sel
+}
+
+// approve runs before-switch hooks once per detected update c and reports whether update is not vetoed.
+// Approval is kept until update is switched or fails, so other update is approved again.
+func (r *Reloader) approve(cmd *executable.Executable, c source.Candidate) bool {
+	key := approvalKey(c)
+	if r.approved == key {
+		return true
+	}
+	r.approved = ""
+	if err := r.fireHooks(OnBeforeSwitch, updateData(cmd, c)); err != nil {
+		r.logEvent("veto", "%s update vetoed: %s", cmd.String(), err.Error())
+		return false
+	}
+	r.approved = key
+	return true
+}
+
+// approvalKey identifies update candidate approved by before-switch hooks.
+func approvalKey(c source.Candidate) string {
+	return c.Checksum + " " + c.Version + " " + c.Location
+}
+
+// switchChild validates fetched update at path and switches stopped child to it. Plain binary is backed up first.
+// Switch is recorded in audit log before binary is replaced and refused if it can't be recorded.
+// Failed update leaves current binary untouched, unless *Error is returned as switching binary failed.
+func (r *Reloader) switchChild(path string, c source.Candidate) error {
+	if err := r.validate(r.cmd, path); err != nil {
+		r.reject(r.cmd, c, err)
 		return err
+	}
+	r.logEvent("switch", "switching %s to %s", r.cmd.Describe(), describeUpdate(path, c))
+	if r.releases != nil {
+		id, installed, err := r.installRelease(path, c)
+		if err != nil {
+			r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+			r.logger.Printf("install release error: %s", err.Error())
+			// broken update is not fetched and installed again on next check
+			r.reject(r.cmd, c, err)
+			return err
+		}
+		if err = r.auditReplace(audit.Switch, r.cmd, r.releaseBinary(id), c); err == nil {
+			err = r.activateRelease(id)
+		} else if installed {
+			// release is installed again when it can be recorded
+			_ = os.RemoveAll(r.releases.Dir(id))
+		}
+		if err != nil {
+			r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+			r.logger.Printf("activate release error: %s", err.Error())
+			return err
+		}
 	} else {
-		if !latest {
-			r.logger.Printf("%s updated", what)
-			return onUpdate()
+		if err := r.auditReplace(audit.Switch, r.cmd, path, c); err != nil {
+			r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+			r.logger.Printf("switch refused: %s", err.Error())
+			return err
+		}
+		if err := r.backupChild(); err != nil {
+			r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+			r.logger.Printf("backup binary error: %s", err.Error())
+			return err
+		}
+		err := r.cmd.SwitchFrom(path)
+		if err == nil {
+			// version reported by update source is kept for binaries not embedding it
+			err = executable.WriteVersion(r.cmd.Path(), c.Version)
+		}
+		if err != nil {
+			r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+			r.logger.Printf("switch binary error: %s", err.Error())
+			return &Error{Op: "switch", Err: err}
 		}
 	}
+	r.emitSwitched(r.cmd, false)
+	_ = r.fireHooks(OnAfterSwitch, eventData(r.cmd))
+	delete(r.pending, r.cmd.String())
+	r.forgive(c)
 	return nil
 }
 
+// emitSwitched emits Switched event comparing switched binary with previous one and records it in update history.
+func (r *Reloader) emitSwitched(prev *executable.Executable, rollback bool) {
+	e := Switched{Timestamp: now(), Path: prev.Path(), From: prev.Checksum()}
+	if cmd, err := executable.NewExecutable(prev.Path()); err == nil {
+		e.To = cmd.Checksum()
+		e.Version = cmd.Version()
+		e.Build = cmd.BuildInfo()
+	}
+	r.emit(e)
+	if rollback {
+		r.recordUpdate("rollback", prev, e.To, e.Version)
+		return
+	}
+	r.recordUpdate("switch", prev, e.To, e.Version)
+}
+
+// describeUpdate returns update description for logging, fetched binary at path is described if it exists.
+func describeUpdate(path string, c source.Candidate) string {
+	if !release.IsBundle(path) {
+		if cmd, err := executable.NewExecutable(path); err == nil {
+			return cmd.Describe()
+		}
+	}
+	s := c.Location
+	if c.Version != "" {
+		s += " " + c.Version
+	}
+	if c.Build != nil {
+		s += " " + c.Build.String()
+	}
+	return s
+}
+
+// eventData returns hook event details for an executable.
+func eventData(cmd *executable.Executable) map[string]string {
+	data := map[string]string{
+		"name":     cmd.String(),
+		"path":     cmd.Path(),
+		"checksum": cmd.Checksum(),
+	}
+	if cmd.Version() != "" {
+		data["version"] = cmd.Version()
+	}
+	if b := cmd.BuildInfo(); b != nil {
+		data["go_version"] = b.GoVersion
+		if b.Revision != "" {
+			data["revision"] = b.Revision
+		}
+	}
+	return data
+}
+
+// updateData returns hook event details for an executable and it's update candidate.
+func updateData(cmd *executable.Executable, c source.Candidate) map[string]string {
+	data := eventData(cmd)
+	data["location"] = c.Location
+	if c.Checksum != "" {
+		data["new_checksum"] = c.Checksum
+	}
+	if c.Version != "" {
+		data["new_version"] = c.Version
+	}
+	return data
+}
+
+// exitData returns hook event details for an exited child process.
+func exitData(cmd *executable.Executable, status executable.ExitStatus) map[string]string {
+	data := eventData(cmd)
+	data["exit_code"] = strconv.Itoa(status.Code)
+	if status.Signal != "" {
+		data["signal"] = status.Signal
+	}
+	if status.CoreDump {
+		data["core_dump"] = "true"
+	}
+	data["duration"] = status.Duration.String()
+	data["cpu_time"] = (status.UserTime + status.SystemTime).String()
+	if status.MaxRSS > 0 {
+		data["max_rss"] = strconv.FormatInt(status.MaxRSS, 10)
+	}
+	return data
+}
+
 // checkExecutable is a helper for checkExecutableError that accepts function not returning error
-func (r Reloader) checkExecutable(cmd *executable.Executable, onUpdate func()) {
-	if err := r.checkExecutableError(cmd, func() error {
-		onUpdate()
+func (r *Reloader) checkExecutable(ctx context.Context, cmd *executable.Executable, onUpdate func(c source.Candidate)) {
+	if err := r.checkExecutableError(ctx, cmd, func(c source.Candidate) error {
+		onUpdate(c)
 		return nil
 	}); err != nil {
 		panic(err)
 	}
 }
 
-// startSelfUpdate starts new process for switching binaries and stops reloader
-func (r Reloader) startSelfUpdate() error {
+// startSelfUpdate starts new process for switching binaries and hands over to updated reloader.
+// Release is called to stop child process before updated reloader starts it's own child. With handover running
+// child is passed to updated reloader instead, release must detach it.
+// Self update must be recorded in audit log by caller, see auditReplace.
+// When nil is returned, reloader must exit. Otherwise previous binary is kept and reloader keeps running.
+func (r *Reloader) startSelfUpdate(ctx context.Context, c source.Candidate, updater string, release func(), handover bool) error {
+	stop := release
+	release = func() {
+		// history is saved before updated reloader reads it
+		r.recordUpdate("self-update", r.self, c.Checksum, c.Version)
+		stop()
+	}
 	args := make([]string, 0, len(os.Args))
 	args = append(args, "--update", r.self.Path())
 	args = append(args, os.Args[1:]...)
 	var err error
 	var cmd *executable.Executable
-	updater := filepath.Join(r.staging, r.self.String())
-	r.logger.Printf("running %s %v", updater, args)
+	r.logEvent("self-update", "running %s %v", updater, args)
+	r.emit(SelfUpdateStarted{Timestamp: now(), Path: updater})
 	if cmd, err = executable.NewExecutable(updater, args...); err != nil {
 		return err
 	}
-	if err = cmd.Start(r.stdout, r.stderr); err != nil {
-		return err
+	if r.daemon {
+		// updater restarts daemon with updated binary and restores previous one if restarted daemon
+		// doesn't report it has started child, see UpdateDaemon
+		release()
+		if err = cmd.Start(os.Stdout, os.Stderr); err != nil {
+			return err
+		}
+		return cmd.Release()
 	}
-	if err = cmd.Release(); err != nil {
+	if handover {
+		var state string
+		var files []*os.File
+		if state, files, err = r.writeHandover(); err != nil {
+			return err
+		}
+		defer func() {
+			// state file is removed by updated reloader
+			if err != nil {
+				removeHandover(state)
+			}
+		}()
+		cmd.SetEnv(handoverEnv + "=" + state)
+		cmd.SetFiles(files...)
+	}
+	if err = r.handoff(ctx, cmd, release); err != nil {
+		r.emit(SelfUpdateFailed{Timestamp: now(), Path: updater, Err: err})
 		return err
 	}
-	r.stopReloader()
-	return errors.New("reloader updated")
+	return nil
 }
 
+// Update replaces reloader binary what with current executable, keeping previous binary as a backup,
+// and restarts it with current command line args except --update flag.
 func (r *Reloader) Update(what string, restart bool) error {
 	r.logger.Printf("Updating %s %s...", what, r.version)
 	var err error
 	var cmd *executable.Executable
-	if cmd, err = executable.NewExecutable(what, r.args...); err != nil {
-		r.logger.Fatalf("self init failed %s", err.Error())
+	var updater string
+	if updater, err = os.Executable(); err != nil {
 		return err
 	}
-	r.logger.Printf("switching from %s", r.staging)
-	if err = cmd.Switch(r.staging); err != nil {
-		r.logger.Fatalf("self switch failed: %s", err.Error())
+	r.logger.Printf("switching from %s", updater)
+	if err = executable.Replace(updater, what); err != nil {
+		r.logger.Printf("self switch failed: %s", err.Error())
 		return err
 	}
 	if !restart {
 		return nil
 	}
+	if cmd, err = executable.NewExecutable(what, restartArgs(os.Args[1:])...); err != nil {
+		r.logger.Printf("self init failed %s", err.Error())
+		return err
+	}
+	if state := os.Getenv(handoverEnv); state != "" {
+		// child output pipes are passed through to updated reloader
+		s, err := loadHandover(state)
+		if err != nil {
+			r.logger.Printf("handover state: %s", err.Error())
+			return err
+		}
+		cmd.SetFiles(s.inheritedFiles()...)
+	}
 	r.logger.Print("restarting")
-	if err = cmd.Start(r.stdout, r.stderr); err != nil {
-		r.logger.Fatalf("self restart failed: %s", err.Error())
+	if err = cmd.Start(os.Stdout, os.Stderr); err != nil {
+		r.logger.Printf("self restart failed: %s", err.Error())
 		return err
 	}
 	return nil
 }
 
+// childVersion returns child version for log fields, short checksum if version is unknown.
+func childVersion(cmd *executable.Executable) string {
+	if v := cmd.Version(); v != "" {
+		return v
+	}
+	return "sha256:" + cmd.Checksum()[:12]
+}
+
+// setField attaches a structured field to reloader and child log sinks supporting it.
+func (r *Reloader) setField(name, value string) {
+	for _, w := range []io.Writer{r.logger.Writer(), r.stdout, r.stderr} {
+		if f, ok := w.(logging.Fielder); ok {
+			f.SetField(name, value)
+		}
+	}
+}
+
+// logEvent logs update event message, passing event name as UPDATE_EVENT field to log sinks supporting it.
+func (r *Reloader) logEvent(event string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if f, ok := r.logger.Writer().(logging.Fielder); ok {
+		if _, err := f.WriteFields([]byte(msg), map[string]string{"UPDATE_EVENT": event}); err == nil {
+			return
+		}
+	}
+	r.logger.Print(msg)
+}
+
 // NewReloader returns a new Reloader instance with default configuration.
 func NewReloader(version string) *Reloader {
 	return &Reloader{
 		Config: Config{
-			version:  version,
-			staging:  "staging",
-			interval: time.Minute,
-			logger:   log.New(os.Stderr, "", log.LstdFlags),
-			stdout:   os.Stdout,
-			stderr:   os.Stderr,
+			version:           version,
+			staging:           "staging",
+			policy:            PolicyImmediate,
+			rollout:           100,
+			interval:          time.Minute,
+			selfUpdateTimeout: 30 * time.Second,
+			logger:            log.New(os.Stderr, "", log.LstdFlags),
+			stdout:            os.Stdout,
+			stderr:            os.Stderr,
 		},
 	}
 }
@@ -0,0 +1,230 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// failEnv makes updated reloader started by tests exit without starting child.
+const failEnv = "RELOADER_TEST_FAIL"
+
+func TestMain(m *testing.M) {
+	// test binary started by self update acts as updated reloader reporting it has started child
+	if os.Getenv(handshakeEnv) != "" {
+		r := newTestReloader()
+		if err := r.confirmHandoff(); err != nil {
+			os.Exit(1)
+		}
+		if os.Getenv(failEnv) != "" {
+			os.Exit(1)
+		}
+		r.completeHandoff()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// supervisor is a reloader running shell script child in a temporary directory.
+type supervisor struct {
+	*Reloader
+	dir     string
+	staging string
+	events  <-chan Event
+}
+
+// newSupervisor returns reloader running script as child, child started marker is written to started file.
+func newSupervisor(t *testing.T, script string, opts ...Option) *supervisor {
+	if runtime.GOOS == "windows" {
+		t.Skip("test children are shell scripts")
+	}
+	dir, err := ioutil.TempDir("", "reloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	staging := filepath.Join(dir, "staging")
+	if err := os.Mkdir(staging, 0755); err != nil {
+		t.Fatal(err)
+	}
+	child := filepath.Join(dir, "child")
+	script = "#!/bin/sh\ntouch " + filepath.Join(dir, "started") + "\n" + script + "\n"
+	if err := ioutil.WriteFile(child, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts = append([]Option{
+		WithChild(child),
+		WithStaging(staging),
+		WithInterval(50 * time.Millisecond),
+		WithSignalHandling(false),
+		WithLogger(log.New(ioutil.Discard, "", 0)),
+		WithStdout(ioutil.Discard),
+		WithStderr(ioutil.Discard),
+	}, opts...)
+	r, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &supervisor{Reloader: r, dir: dir, staging: staging, events: r.Events()}
+}
+
+// start runs reloader in background and waits until child is started.
+func (s *supervisor) start(t *testing.T, ctx context.Context) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- s.RunContext(ctx)
+	}()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e := <-s.events:
+			if _, ok := e.(ChildStarted); ok {
+				return result
+			}
+		case err := <-result:
+			t.Fatalf("reloader exited: %v", err)
+		case <-timeout:
+			t.Fatal("child is not started")
+		}
+	}
+}
+
+// wait returns Run result.
+func wait(t *testing.T, result <-chan error) error {
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("reloader is not stopped")
+		return nil
+	}
+}
+
+// started checks whether child has been started.
+func (s *supervisor) started() bool {
+	_, err := os.Stat(filepath.Join(s.dir, "started"))
+	return err == nil
+}
+
+func TestStopBeforeRun(t *testing.T) {
+	testCases := []struct {
+		name string
+		stop func(r *Reloader) error
+	}{
+		{"stop", func(r *Reloader) error {
+			r.Stop()
+			return nil
+		}},
+		{"shutdown", func(r *Reloader) error {
+			return r.Shutdown(context.Background())
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSupervisor(t, "sleep 10")
+			if err := tc.stop(s.Reloader); err != nil {
+				t.Fatal(err)
+			}
+			result := make(chan error, 1)
+			go func() {
+				result <- s.Run()
+			}()
+			if err := wait(t, result); err != nil {
+				t.Fatal(err)
+			}
+			if s.started() {
+				t.Fatal("child is started by stopped reloader")
+			}
+		})
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	s := newSupervisor(t, "exec sleep 10")
+	ctx, cancel := context.WithCancel(context.Background())
+	result := s.start(t, ctx)
+	cancel()
+	if err := wait(t, result); err != context.Canceled {
+		t.Fatalf("error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := newSupervisor(t, "exec sleep 10", WithExitCode(true))
+	result := s.start(t, context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// child terminated by reloader is not reported as child exit
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatal("Shutdown returned before Run")
+	}
+	// stopped reloader is not started again
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChildExitError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		exitCode bool
+		err      bool
+	}{
+		{"reported", true, true},
+		{"not reported", false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSupervisor(t, "exit 3", WithExitCode(tc.exitCode))
+			err := s.Run()
+			var exitErr *ChildExitError
+			if !tc.err {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("error %v, expected ChildExitError", err)
+			}
+			if exitErr.Status.Code != 3 || exitErr.Status.ShellCode() != 3 {
+				t.Fatalf("unexpected exit status %+v", exitErr.Status)
+			}
+		})
+	}
+}
+
+func TestErrUpdated(t *testing.T) {
+	s := newSupervisor(t, "exec sleep 10")
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// test binary with appended byte is an update of itself, see TestMain
+	data, err := ioutil.ReadFile(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged := filepath.Join(s.staging, filepath.Base(self))
+	if err := ioutil.WriteFile(staged, append(data, 0), 0755); err != nil {
+		t.Fatal(err)
+	}
+	result := s.start(t, context.Background())
+	if err := wait(t, result); err != ErrUpdated {
+		t.Fatalf("error %v, expected %v", err, ErrUpdated)
+	}
+}
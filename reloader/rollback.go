@@ -0,0 +1,211 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/audit"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"github.com/tumb1er/go-reloader/reloader/state"
+	"github.com/tumb1er/go-reloader/reloader/version"
+	"os"
+	"path/filepath"
+)
+
+// rolledBack is a reason for refusing rolled back binaries.
+const rolledBack = "rolled back"
+
+// backupChild keeps child binary and it's version as <child>.bak before it is replaced.
+func (r *Reloader) backupChild() error {
+	if err := executable.Backup(r.cmd.Path()); err != nil {
+		return err
+	}
+	return executable.WriteVersion(r.cmd.Path()+executable.BackupSuffix, r.cmd.Version())
+}
+
+// rollbackCandidate returns binary to roll back child to: binary of installed release with id or version to,
+// of release installed before current one if to is empty, or backup of child binary replaced last.
+func (r *Reloader) rollbackCandidate(to string) (source.Candidate, error) {
+	name := filepath.Base(r.child)
+	path := r.child + executable.BackupSuffix
+	if r.releases != nil {
+		id, err := r.rollbackRelease(to)
+		if err != nil {
+			return source.Candidate{}, err
+		}
+		path = filepath.Join(r.releases.Dir(id), name)
+	}
+	cmd, err := executable.NewExecutable(path)
+	if os.IsNotExist(err) && r.releases == nil {
+		return source.Candidate{}, fmt.Errorf("no backup of %s to roll back to", name)
+	}
+	if err != nil {
+		return source.Candidate{}, err
+	}
+	if r.releases == nil {
+		if to != "" && version.Compare(cmd.Version(), to) != 0 {
+			return source.Candidate{}, fmt.Errorf("backup %s version is %q, not %s", path, cmd.Version(), to)
+		}
+		if cmd.Checksum() == r.cmd.Checksum() {
+			return source.Candidate{}, fmt.Errorf("backup %s is the same as current binary", path)
+		}
+	}
+	return source.Candidate{Name: name, Location: path, Checksum: cmd.Checksum(), Version: cmd.Version()}, nil
+}
+
+// rollbackRelease returns id of installed release to roll back to: release with id or child version to,
+// or release installed before current one.
+func (r *Reloader) rollbackRelease(to string) (string, error) {
+	current := r.currentRelease()
+	if to == "" {
+		return r.releases.Previous()
+	}
+	id := to
+	if !r.releases.Exists(id) {
+		list, err := r.releases.List()
+		if err != nil {
+			return "", err
+		}
+		id = ""
+		for _, info := range list {
+			v := executable.ReadVersion(filepath.Join(r.releases.Dir(info.ID), filepath.Base(r.child)))
+			if v != "" && version.Compare(v, to) == 0 {
+				id = info.ID
+			}
+		}
+	}
+	if id == "" {
+		return "", fmt.Errorf("release %s is not installed", to)
+	}
+	if id == current {
+		return "", fmt.Errorf("release %s is current", id)
+	}
+	return id, nil
+}
+
+// switchBack switches child to validated rollback candidate c. Release is activated while child may be running,
+// plain binary is switched while child is stopped and replaced binary becomes a backup; it is refused as an update,
+// so it is not applied again. Rollback is recorded in audit log before binary is replaced and refused if it can't
+// be recorded. *Error is returned if switching binary failed.
+func (r *Reloader) switchBack(c source.Candidate) error {
+	r.logEvent("rollback", "rolling back %s to %s", r.cmd.Describe(), describeUpdate(c.Location, c))
+	prev := r.cmd
+	// rollback is refused if it can't be recorded in audit log
+	if err := r.auditReplace(audit.Rollback, prev, c.Location, c); err != nil {
+		r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+		r.logger.Printf("rollback refused: %s", err.Error())
+		return err
+	}
+	if r.releases != nil {
+		if err := r.releases.Activate(filepath.Base(filepath.Dir(c.Location))); err != nil {
+			r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+			r.logger.Printf("activate release error: %s", err.Error())
+			return err
+		}
+	} else {
+		// backup is replaced with current binary, so binary is switched from it's copy
+		tmp := r.child + ".rollback"
+		if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := executable.CopyFile(c.Location, tmp); err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(tmp) }()
+		if err := r.backupChild(); err != nil {
+			r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+			r.logger.Printf("backup binary error: %s", err.Error())
+			return err
+		}
+		err := r.cmd.SwitchFrom(tmp)
+		if err == nil {
+			err = executable.WriteVersion(r.cmd.Path(), c.Version)
+		}
+		if err != nil {
+			r.emit(SwitchFailed{Timestamp: now(), Path: r.cmd.Path(), Err: err})
+			r.logger.Printf("switch binary error: %s", err.Error())
+			return &Error{Op: "rollback", Err: err}
+		}
+		r.refuseRolledBack(prev)
+	}
+	r.emitSwitched(prev, true)
+	_ = r.fireHooks(OnRollback, eventData(prev))
+	return nil
+}
+
+// refuseRolledBack remembers rolled back binary, so it is applied again only when it's version is requested.
+func (r *Reloader) refuseRolledBack(cmd *executable.Executable) {
+	if r.invalid == nil {
+		r.invalid = make(map[string]string)
+	}
+	r.invalid[cmd.Checksum()] = rolledBack
+	r.recordFailure(cmd, cmd.Checksum(), source.Candidate{Checksum: cmd.Checksum(), Version: cmd.Version()}, rolledBack)
+}
+
+// forgive stops refusing rolled back binary applied on request.
+func (r *Reloader) forgive(c source.Candidate) {
+	if _, ok := r.invalid[c.Checksum]; !ok {
+		return
+	}
+	delete(r.invalid, c.Checksum)
+	r.updateState(func(st *state.State) { delete(st.Failures, c.Checksum) })
+}
+
+// initStopped initializes child executable, state and audit log for commands run while reloader is not running.
+func (r *Reloader) initStopped() error {
+	if err := r.initChild(); err != nil {
+		return &Error{Op: "child init", Err: err}
+	}
+	if err := r.openState(); err != nil {
+		return &Error{Op: "state open", Err: err}
+	}
+	r.openAudit()
+	r.actor = actorCommand
+	return nil
+}
+
+// ApplyStopped applies child update with version v, or latest update if v is empty, while reloader is not running.
+// Update is approved by hooks, validated, backed up and recorded as in Run regardless of update policy, but child
+// is not started.
+func (r *Reloader) ApplyStopped(ctx context.Context, v string) error {
+	if err := r.initStopped(); err != nil {
+		return err
+	}
+	r.target = v
+	c, err := r.checkSettled(ctx, r.cmd)
+	if err == source.ErrNoUpdate {
+		return ErrNoPending
+	}
+	if err != nil {
+		return err
+	}
+	if reason, ignore := r.screen(r.cmd, c); ignore && reason == "" {
+		return ErrNoPending
+	} else if reason != "" {
+		return errors.New(reason)
+	}
+	if !r.approve(r.cmd, c) {
+		return errors.New("update is vetoed by before-switch hook, see reloader log")
+	}
+	path, err := r.updateSource().Fetch(ctx, c)
+	if err != nil {
+		return err
+	}
+	return r.switchChild(path, c)
+}
+
+// RollbackStopped switches child back to previous binary or release while reloader is not running, see Rollback.
+func (r *Reloader) RollbackStopped(ctx context.Context, to string) error {
+	if err := r.initStopped(); err != nil {
+		return err
+	}
+	c, err := r.rollbackCandidate(to)
+	if err != nil {
+		return err
+	}
+	if err := r.validateBinary(r.cmd, c.Location); err != nil {
+		return err
+	}
+	return r.switchBack(c)
+}
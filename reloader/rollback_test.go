@@ -0,0 +1,138 @@
+package reloader
+
+import (
+	"context"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/release"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// otherChild is a child binary different from one written by newSupervisor.
+const otherChild = "#!/bin/sh\nexit 0\n"
+
+func TestRollbackStopped(t *testing.T) {
+	s := newSupervisor(t, "exit 0")
+	child := filepath.Join(s.dir, "child")
+	current, err := ioutil.ReadFile(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without backup there is nothing to roll back to
+	if err := s.RollbackStopped(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "no backup") {
+		t.Fatalf("error %v, expected missing backup", err)
+	}
+	if err := ioutil.WriteFile(child+executable.BackupSuffix, []byte(otherChild), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := executable.WriteVersion(child+executable.BackupSuffix, "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RollbackStopped(context.Background(), "1.1.0"); err == nil || !strings.Contains(err.Error(), `"1.0.0", not 1.1.0`) {
+		t.Fatalf("error %v, expected version mismatch", err)
+	}
+	if err := s.RollbackStopped(context.Background(), "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	// replaced binary becomes a backup
+	for path, expected := range map[string]string{child: otherChild, child + executable.BackupSuffix: string(current)} {
+		if data, err := ioutil.ReadFile(path); err != nil || string(data) != expected {
+			t.Fatalf("%s: %q, %v", path, data, err)
+		}
+	}
+	if v := executable.ReadVersion(child); v != "1.0.0" {
+		t.Fatalf("child version %q", v)
+	}
+	// rolled back binary is not applied as an update again
+	sum, err := executable.NewExecutable(child + executable.BackupSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.invalid[sum.Checksum()] != rolledBack {
+		t.Fatalf("rolled back binary is not refused: %v", s.invalid)
+	}
+}
+
+func TestRollbackRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "releases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	r := newTestReloader()
+	r.releases = release.New(dir)
+	r.child = filepath.Join(r.releases.CurrentDir(), "app")
+	for _, id := range []string{"a", "b", "c"} {
+		if err := r.releases.Install(id, func(dir string) error {
+			path := filepath.Join(dir, "app")
+			if err := ioutil.WriteFile(path, []byte(id), 0755); err != nil {
+				return err
+			}
+			// release ids are not versions
+			return executable.WriteVersion(path, map[string]string{"a": "1.0.0", "b": "1.1.0", "c": "1.2.0"}[id])
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.releases.Activate("c"); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		to string
+		id string
+		// expected error message, empty if rollback is possible
+		err string
+	}{
+		{"", "b", ""},
+		{"a", "a", ""},
+		{"1.0.0", "a", ""},
+		{"c", "", "release c is current"},
+		{"1.2.0", "", "release c is current"},
+		{"2.0.0", "", "release 2.0.0 is not installed"},
+	}
+	for _, tc := range testCases {
+		id, err := r.rollbackRelease(tc.to)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: error %v, expected %s", tc.to, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || id != tc.id {
+			t.Errorf("%q: release %s, %v", tc.to, id, err)
+		}
+	}
+}
+
+func TestApplyStopped(t *testing.T) {
+	s := newSupervisor(t, "exit 0")
+	if err := s.ApplyStopped(context.Background(), ""); err != ErrNoPending {
+		t.Fatalf("error %v, expected %v", err, ErrNoPending)
+	}
+	staged := filepath.Join(s.staging, "child")
+	if err := ioutil.WriteFile(staged, []byte(otherChild), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(staged+source.ReadySuffix, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.SetReadyMarker(true)
+	if err := s.ApplyStopped(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	child := filepath.Join(s.dir, "child")
+	if data, err := ioutil.ReadFile(child); err != nil || string(data) != otherChild {
+		t.Fatalf("child is not switched: %q, %v", data, err)
+	}
+	// replaced binary is kept for rollback, child is not started
+	if _, err := ioutil.ReadFile(child + executable.BackupSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if s.started() {
+		t.Fatal("child is started")
+	}
+}
@@ -0,0 +1,68 @@
+package reloader
+
+import (
+	"context"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"hash/fnv"
+	"os"
+	"time"
+)
+
+// rolloutPoint returns stable position of a host in [0, 1) for an update and a purpose.
+// Hosts with the same name get the same position, so rollout decisions survive restarts.
+func rolloutPoint(host, purpose string, c source.Candidate) float64 {
+	key := c.Version
+	if key == "" {
+		key = c.Checksum
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(purpose + "\x00" + host + "\x00" + c.Name + "\x00" + key))
+	return float64(h.Sum64()%10000) / 10000
+}
+
+// hostname returns host name used for rollout decisions.
+func (r *Reloader) hostname() string {
+	if r.host == "" {
+		r.host, _ = os.Hostname()
+	}
+	return r.host
+}
+
+// rolloutPercent returns percentage of hosts taking an update from source manifest or configuration.
+func (r *Reloader) rolloutPercent(ctx context.Context, c source.Candidate) int {
+	percent := r.rollout
+	ms, ok := r.updateSource().(source.ManifestSource)
+	if !ok {
+		return percent
+	}
+	m, err := ms.Manifest(ctx)
+	if err != nil {
+		r.logger.Printf("manifest error: %s", err.Error())
+		return percent
+	}
+	if m == nil {
+		return percent
+	}
+	if a, ok := m.Find(c); ok && a.Rollout != nil {
+		percent = *a.Rollout
+	}
+	return percent
+}
+
+// rolloutReason returns why rollout settings hold an update at t, empty if it may be applied.
+func (r *Reloader) rolloutReason(ctx context.Context, cmd *executable.Executable, c source.Candidate, t time.Time) string {
+	percent := r.rolloutPercent(ctx, c)
+	if rolloutPoint(r.hostname(), "rollout", c)*100 >= float64(percent) {
+		return fmt.Sprintf("host is not in %d%% rollout", percent)
+	}
+	if r.rolloutDelay <= 0 {
+		return ""
+	}
+	delay := time.Duration(rolloutPoint(r.hostname(), "delay", c) * float64(r.rolloutDelay))
+	if after := r.detected(cmd, c, t).Add(delay); t.Before(after) {
+		return "rollout delay until " + after.Format(time.RFC3339)
+	}
+	return ""
+}
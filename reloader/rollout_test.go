@@ -0,0 +1,132 @@
+package reloader
+
+import (
+	"context"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/schedule"
+	"github.com/tumb1er/go-reloader/reloader/source"
+	"strings"
+	"testing"
+	"time"
+)
+
+// manifestSource is an update source publishing manifest.
+type manifestSource struct {
+	noUpdates
+	manifest *source.Manifest
+}
+
+// Manifest returns published manifest.
+func (s manifestSource) Manifest(context.Context) (*source.Manifest, error) {
+	return s.manifest, nil
+}
+
+func TestRolloutPoint(t *testing.T) {
+	c := source.Candidate{Name: "app", Version: "1.2.0", Checksum: "a"}
+	p := rolloutPoint("host", "rollout", c)
+	if p < 0 || p >= 1 {
+		t.Fatalf("point %f", p)
+	}
+	// position is stable for a build, checksum is used only without version
+	if rolloutPoint("host", "rollout", source.Candidate{Name: "app", Version: "1.2.0", Checksum: "b"}) != p {
+		t.Fatal("position depends on checksum of versioned build")
+	}
+	if rolloutPoint("host", "rollout", source.Candidate{Name: "app", Checksum: "a"}) ==
+		rolloutPoint("host", "rollout", source.Candidate{Name: "app", Checksum: "b"}) {
+		t.Fatal("position doesn't depend on checksum of unversioned build")
+	}
+	if rolloutPoint("host", "delay", c) == p {
+		t.Fatal("rollout and delay positions are the same")
+	}
+	// hosts are spread evenly
+	in := 0
+	for i := 0; i < 1000; i++ {
+		if rolloutPoint(fmt.Sprintf("host%d", i), "rollout", c) < 0.3 {
+			in++
+		}
+	}
+	if in < 250 || in > 350 {
+		t.Fatalf("%d of 1000 hosts in 30%% rollout", in)
+	}
+}
+
+func TestRolloutReason(t *testing.T) {
+	c := source.Candidate{Name: "app", Version: "1.2.0", Checksum: "a"}
+	hundred, zero := 100, 0
+	testCases := []struct {
+		name     string
+		rollout  int
+		delay    time.Duration
+		manifest *source.Manifest
+		// time passed since update detection
+		detected time.Duration
+		reason   string
+	}{
+		{"everyone", 100, 0, nil, 0, ""},
+		{"nobody", 0, 0, nil, 0, "host is not in 0% rollout"},
+		{"manifest rollout", 0, 0, &source.Manifest{Artifacts: []source.Artifact{{Name: "app", Rollout: &hundred}}}, 0, ""},
+		{"manifest for another build", 0, 0,
+			&source.Manifest{Artifacts: []source.Artifact{{Name: "app", Version: "1.3.0", Rollout: &hundred}}}, 0,
+			"host is not in 0% rollout"},
+		{"manifest stops rollout", 100, 0, &source.Manifest{Artifacts: []source.Artifact{{Name: "app", Rollout: &zero}}},
+			0, "host is not in 0% rollout"},
+		{"delay", 100, time.Hour, nil, 0, "rollout delay until "},
+		{"delay passed", 100, time.Hour, nil, time.Hour, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestReloader()
+			r.SetHostname("host")
+			r.SetRollout(tc.rollout)
+			r.SetRolloutDelay(tc.delay)
+			if tc.manifest != nil {
+				r.SetUpdateSource(manifestSource{manifest: tc.manifest})
+			}
+			cmd := &executable.Executable{}
+			now := time.Now()
+			r.pending = map[string]Pending{cmd.String(): {Name: cmd.String(), Version: c.Version, Checksum: c.Checksum,
+				Detected: now.Add(-tc.detected)}}
+			reason := r.rolloutReason(context.Background(), cmd, c, now)
+			if tc.reason == "" && reason != "" || !strings.HasPrefix(reason, tc.reason) {
+				t.Fatalf("reason %q, expected %q", reason, tc.reason)
+			}
+		})
+	}
+}
+
+func TestHoldReason(t *testing.T) {
+	c := source.Candidate{Name: "app", Version: "1.2.0", Checksum: "a"}
+	// Saturday, maintenance window is from 02:00 to 03:00
+	day := time.Date(2020, 1, 18, 0, 0, 0, 0, time.UTC)
+	w, err := schedule.NewWindow("0 2 * * *", time.Hour, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name    string
+		policy  UpdatePolicy
+		rollout int
+		at      time.Duration
+		reason  string
+	}{
+		{"immediate", PolicyImmediate, 100, time.Hour, ""},
+		{"window closed", PolicyWindow, 100, time.Hour, "waiting for maintenance window at 2020-01-18T02:00:00Z"},
+		{"window open", PolicyWindow, 100, 2*time.Hour + 30*time.Minute, ""},
+		{"manual", PolicyManual, 100, time.Hour, "waiting for apply command"},
+		// rollout is checked before update policy
+		{"not in rollout", PolicyManual, 0, time.Hour, "host is not in 0% rollout"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestReloader()
+			r.SetHostname("host")
+			r.SetRollout(tc.rollout)
+			r.SetUpdatePolicy(tc.policy)
+			r.AddMaintenanceWindow(w)
+			if reason := r.holdReason(context.Background(), &executable.Executable{}, c, day.Add(tc.at)); reason != tc.reason {
+				t.Fatalf("reason %q, expected %q", reason, tc.reason)
+			}
+		})
+	}
+}
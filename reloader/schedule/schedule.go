@@ -0,0 +1,193 @@
+// Package schedule implements cron-style maintenance windows.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field describes allowed values of a cron expression field.
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Schedule is a parsed 5-field cron expression: minute, hour, day of month, month and day of week.
+type Schedule struct {
+	spec   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+	loc    *time.Location
+}
+
+// Parse parses cron expression evaluated in loc, UTC is used if loc is nil.
+func Parse(spec string, loc *time.Location) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q: expected %d fields, got %d", spec, len(fields), len(parts))
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	s := &Schedule{spec: spec, loc: loc}
+	masks := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, part := range parts {
+		mask, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s", spec, err.Error())
+		}
+		*masks[i] = mask
+	}
+	// sunday may be set as 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.anyDom = strings.HasPrefix(parts[2], "*")
+	s.anyDow = strings.HasPrefix(parts[4], "*")
+	return s, nil
+}
+
+// parseField parses comma-separated list of values, ranges and steps into a bit mask.
+func parseField(s string, f field) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step: %s", f.name, item)
+			}
+			step, item = n, item[:i]
+		}
+		lo, hi := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid %s range: %s", f.name, item)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+// value parses a numeric or named field value.
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s: %s", f.name, s)
+	}
+	return v, nil
+}
+
+// String returns cron expression.
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// matchDay checks day of month and day of week, as cron does either of them matches if both are restricted.
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns first time matching schedule after t.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	// no match within 5 years means schedule never matches, i.e. February 30th
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Window is a maintenance window starting at schedule times and lasting for a duration.
+type Window struct {
+	Schedule *Schedule
+	Duration time.Duration
+}
+
+// Contains checks whether t is within a window.
+func (w Window) Contains(t time.Time) bool {
+	start := w.Schedule.Next(t.Add(-w.Duration))
+	return !start.IsZero() && !start.After(t)
+}
+
+// Next returns next window start after t.
+func (w Window) Next(t time.Time) time.Time {
+	return w.Schedule.Next(t)
+}
+
+// String returns window description.
+func (w Window) String() string {
+	return fmt.Sprintf("%s for %s", w.Schedule, w.Duration)
+}
+
+// NewWindow returns maintenance window starting at cron expression times in loc.
+func NewWindow(spec string, duration time.Duration, loc *time.Location) (Window, error) {
+	if duration <= 0 {
+		return Window{}, errors.New("maintenance window duration must be positive")
+	}
+	s, err := Parse(spec, loc)
+	if err != nil {
+		return Window{}, err
+	}
+	return Window{Schedule: s, Duration: duration}, nil
+}
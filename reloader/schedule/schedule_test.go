@@ -0,0 +1,124 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseField(t *testing.T) {
+	minute, month, dow := fields[0], fields[3], fields[4]
+	testCases := []struct {
+		s        string
+		f        field
+		expected uint64
+		err      bool
+	}{
+		{"*", month, 0x1ffe, false},
+		{"5", minute, 1 << 5, false},
+		{"1,3,5", minute, 1<<1 | 1<<3 | 1<<5, false},
+		{"10-12", minute, 1<<10 | 1<<11 | 1<<12, false},
+		{"*/20", minute, 1<<0 | 1<<20 | 1<<40, false},
+		{"50/5", minute, 1<<50 | 1<<55, false},
+		{"0-10/5", minute, 1<<0 | 1<<5 | 1<<10, false},
+		{"jan,MAR", month, 1<<1 | 1<<3, false},
+		{"mon-fri", dow, 0x3e, false},
+		{"7", dow, 1 << 7, false},
+		{"60", minute, 0, true},
+		{"0", month, 0, true},
+		{"12-10", minute, 0, true},
+		{"*/0", minute, 0, true},
+		{"*/x", minute, 0, true},
+		{"1-", minute, 0, true},
+		{"foo", dow, 0, true},
+		{"", minute, 0, true},
+	}
+	for _, tc := range testCases {
+		mask, err := parseField(tc.s, tc.f)
+		if tc.err {
+			if err == nil {
+				t.Errorf("parseField(%q, %s) = %x, expected error", tc.s, tc.f.name, mask)
+			}
+			continue
+		}
+		if err != nil || mask != tc.expected {
+			t.Errorf("parseField(%q, %s) = %x, %v, expected %x", tc.s, tc.f.name, mask, err, tc.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "* * * * * *", "61 * * * *", "* 24 * * *", "* * 32 * *",
+		"* * * 13 *", "* * * * 8", "* * * foo *"} {
+		if _, err := Parse(spec, nil); err == nil {
+			t.Errorf("Parse(%q): expected error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2020-01-20 is monday
+	from := time.Date(2020, 1, 20, 10, 30, 15, 0, time.UTC)
+	testCases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2020, 1, 20, 10, 31, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2020, 1, 21, 2, 0, 0, 0, time.UTC)},
+		{"45 10 * * *", time.Date(2020, 1, 20, 10, 45, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2020, 1, 21, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 1, 20, 10, 45, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 3 * * sat,sun", time.Date(2020, 1, 25, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2020, 1, 26, 3, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// day of month or day of week matches when both are restricted
+		{"0 0 25 * fri", time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 feb *", time.Time{}},
+	}
+	for _, tc := range testCases {
+		s, err := Parse(tc.spec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := s.Next(from); !next.Equal(tc.expected) {
+			t.Errorf("%q: next after %s is %s, expected %s", tc.spec, from, next, tc.expected)
+		}
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	s, err := Parse("0 2 * * *", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := s.Next(time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC))
+	if expected := time.Date(2020, 1, 20, 23, 0, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Fatalf("next is %s, expected %s", next, expected)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w, err := NewWindow("0 2 * * *", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		t        time.Time
+		expected bool
+	}{
+		{time.Date(2020, 1, 20, 1, 59, 0, 0, time.UTC), false},
+		{time.Date(2020, 1, 20, 2, 0, 0, 0, time.UTC), true},
+		{time.Date(2020, 1, 20, 2, 59, 59, 0, time.UTC), true},
+		{time.Date(2020, 1, 20, 3, 0, 0, 0, time.UTC), false},
+	}
+	for _, tc := range testCases {
+		if contains := w.Contains(tc.t); contains != tc.expected {
+			t.Errorf("window contains %s: %v, expected %v", tc.t, contains, tc.expected)
+		}
+	}
+	if _, err := NewWindow("0 2 * * *", 0, nil); err == nil {
+		t.Error("expected error for empty window")
+	}
+}
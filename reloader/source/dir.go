@@ -0,0 +1,267 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/delta"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/release"
+	"github.com/tumb1er/go-reloader/reloader/version"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// delta patch file suffix, patches are named <name>.<base checksum>-<target checksum>.bsdiff
+	deltaSuffix = ".bsdiff"
+	// patched binary file suffix
+	patchedSuffix = ".patched"
+)
+
+// Dir is an update source looking for a delta patch for current binary, a binary with the same name
+// in staging directory or a bundle archive named after the binary, i.e. app.tar.gz.
+type Dir struct {
+	dir string
+	// chooses artifacts when staging directory contains a manifest
+	selector Selector
+	// argument printing staged binary version, i.e. --version, versions are not probed if empty
+	versionArg string
+	// require ready markers for staged files
+	readyMarker bool
+	// staged files state on previous check
+	seen map[string]observation
+	// staged binaries runnable on current platform by checksum, see runnable
+	arch map[string]bool
+}
+
+// Check looks for a delta patch for current executable and falls back to comparing current executable
+// with a binary with the same name in staging directory.
+// Staged binary is considered an update if it has different checksum and a different version. If versions
+// are unknown or equal, staged binary must not be older than current one. Version ordering is left to caller.
+// ErrNotReady is returned while staged file is still being written, see ready.
+func (d *Dir) Check(ctx context.Context, current *executable.Executable) (Candidate, error) {
+	m, err := d.Manifest(ctx)
+	if err != nil {
+		return Candidate{}, err
+	}
+	if m != nil && m.Has(current.String()) {
+		return d.checkManifest(m, current)
+	}
+	if c, err := d.checkDelta(current); err != ErrNoUpdate {
+		return c, err
+	}
+	stage, err := current.Staged(d.dir)
+	if os.IsNotExist(err) {
+		return d.checkBundle(current)
+	}
+	if err != nil {
+		return Candidate{}, err
+	}
+	if stage.Checksum() == current.Checksum() {
+		return Candidate{}, ErrNoUpdate
+	}
+	if err := d.ready(stage.Path(), stage.Checksum(), false); err != nil {
+		return Candidate{}, err
+	}
+	// binaries built for another platform are not run, they are left for caller validation to reject
+	if d.runnable(stage) {
+		if err := stage.ProbeVersion(d.versionArg); err != nil {
+			return Candidate{}, err
+		}
+	}
+	sameVersion := stage.Version() == "" || current.Version() == "" || version.Compare(stage.Version(), current.Version()) == 0
+	if sameVersion && stage.Modified().Before(current.Modified()) {
+		return Candidate{}, ErrNoUpdate
+	}
+	return Candidate{
+		Name:     current.String(),
+		Location: stage.Path(),
+		Checksum: stage.Checksum(),
+		Version:  stage.Version(),
+		Modified: stage.Modified(),
+		Build:    stage.BuildInfo(),
+	}, nil
+}
+
+// checkBundle looks for a bundle archive named after current executable in staging directory.
+// Bundle is always returned as a candidate, it's up to caller to compare it with installed releases.
+func (d *Dir) checkBundle(current *executable.Executable) (Candidate, error) {
+	for _, suffix := range release.BundleSuffixes {
+		path := filepath.Join(d.dir, current.String()+suffix)
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return Candidate{}, err
+		}
+		if err := d.ready(path, sum, false); err != nil {
+			return Candidate{}, err
+		}
+		return Candidate{
+			Name:     current.String(),
+			Location: path,
+			Checksum: sum,
+			Modified: fi.ModTime(),
+		}, nil
+	}
+	return Candidate{}, ErrNoUpdate
+}
+
+// checkManifest returns artifact selected from manifest if it differs from current executable.
+func (d *Dir) checkManifest(m *Manifest, current *executable.Executable) (Candidate, error) {
+	a, ok := m.Select(current.String(), d.selector)
+	if !ok {
+		return Candidate{}, ErrNoUpdate
+	}
+	path := filepath.Join(d.dir, a.Path())
+	fi, err := os.Stat(path)
+	if err != nil {
+		return Candidate{}, err
+	}
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return Candidate{}, err
+	}
+	if sum == current.Checksum() {
+		return Candidate{}, ErrNoUpdate
+	}
+	// manifest is written last, so file matching it's checksum is complete
+	if a.Checksum != "" && a.Checksum != sum {
+		return Candidate{}, fmt.Errorf("%w: %s checksum doesn't match manifest", ErrNotReady, path)
+	}
+	if err := d.ready(path, sum, a.Checksum != ""); err != nil {
+		return Candidate{}, err
+	}
+	// bundles and non-Go binaries don't have build info
+	build, _ := executable.ReadBuildInfo(path)
+	return Candidate{
+		Name:     current.String(),
+		Location: path,
+		Checksum: sum,
+		Version:  a.Version,
+		Modified: fi.ModTime(),
+		Selected: true,
+		Build:    build,
+	}, nil
+}
+
+// checkDelta looks for a delta patch with base checksum matching current executable.
+func (d *Dir) checkDelta(current *executable.Executable) (Candidate, error) {
+	entries, err := ioutil.ReadDir(d.dir)
+	if os.IsNotExist(err) {
+		return Candidate{}, ErrNoUpdate
+	}
+	if err != nil {
+		return Candidate{}, err
+	}
+	prefix := current.String() + "." + current.Checksum() + "-"
+	for _, fi := range entries {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, deltaSuffix) {
+			continue
+		}
+		target := strings.TrimSuffix(strings.TrimPrefix(name, prefix), deltaSuffix)
+		if target == "" || target == current.Checksum() {
+			continue
+		}
+		path := filepath.Join(d.dir, name)
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return Candidate{}, err
+		}
+		if err := d.ready(path, sum, false); err != nil {
+			return Candidate{}, err
+		}
+		return Candidate{
+			Name:     current.String(),
+			Location: path,
+			Base:     current.Path(),
+			Checksum: target,
+			Modified: fi.ModTime(),
+		}, nil
+	}
+	return Candidate{}, ErrNoUpdate
+}
+
+// Fetch returns staged binary path as it is already on local file system.
+// Delta patches are applied to base binary, patched binary is kept in staging directory.
+func (d *Dir) Fetch(ctx context.Context, c Candidate) (string, error) {
+	if c.Base == "" {
+		return c.Location, nil
+	}
+	dst := filepath.Join(d.dir, "."+c.Name+patchedSuffix)
+	if sum, err := fileChecksum(dst); err == nil && sum == c.Checksum {
+		// patch is already applied but not switched yet
+		return dst, nil
+	}
+	old, err := ioutil.ReadFile(c.Base)
+	if err != nil {
+		return "", err
+	}
+	patch, err := ioutil.ReadFile(c.Location)
+	if err != nil {
+		return "", err
+	}
+	data, err := delta.Apply(old, patch)
+	if err == nil && hexSHA256(data) != c.Checksum {
+		err = fmt.Errorf("checksum mismatch: expected %s, got %s", c.Checksum, hexSHA256(data))
+	}
+	if err != nil {
+		// broken patch is removed, so full binary is used next time
+		_ = os.Remove(c.Location)
+		return "", fmt.Errorf("patch %s: %s", c.Location, err.Error())
+	}
+	if err := ioutil.WriteFile(dst+partSuffix, data, 0751); err != nil {
+		return "", err
+	}
+	if err := os.Rename(dst+partSuffix, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// Manifest reads manifest from staging directory.
+func (d *Dir) Manifest(ctx context.Context) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.dir, ManifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// SetSelector configures manifest artifacts selection.
+func (d *Dir) SetSelector(sel Selector) {
+	d.selector = sel
+}
+
+// SetVersionArg configures argument printing staged binary version, i.e. --version.
+func (d *Dir) SetVersionArg(arg string) {
+	d.versionArg = arg
+}
+
+// runnable checks staged binary architecture before it is run to probe version, result is cached by checksum.
+func (d *Dir) runnable(stage *executable.Executable) bool {
+	ok, checked := d.arch[stage.Checksum()]
+	if !checked {
+		ok = executable.CheckArch(stage.Path()) == nil
+		d.arch[stage.Checksum()] = ok
+	}
+	return ok
+}
+
+// Path returns staging directory path.
+func (d *Dir) Path() string {
+	return d.dir
+}
+
+// NewDir returns an update source for staging directory.
+func NewDir(dir string) *Dir {
+	return &Dir{dir: dir, seen: make(map[string]observation), arch: make(map[string]bool)}
+}
@@ -0,0 +1,59 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDirCheckArch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("staged binaries are shell scripts")
+	}
+	testCases := []struct {
+		name    string
+		content string
+		version string
+	}{
+		{"script", "#!/bin/sh\necho app 1.2.0\n", "1.2.0"},
+		// binary for another platform would fail to run
+		{"not an executable", "MZ not an executable", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			current, cleanup := newTestExecutable(t, "#!/bin/sh\necho app 1.1.0\n")
+			defer cleanup()
+			staging, err := ioutil.TempDir("", "staging")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = os.RemoveAll(staging) }()
+			if err := ioutil.WriteFile(filepath.Join(staging, "app"), []byte(tc.content), 0755); err != nil {
+				t.Fatal(err)
+			}
+			d := NewDir(staging)
+			d.SetVersionArg("--version")
+			// staged file is ready when it is not changed since previous check
+			if _, err := d.Check(context.Background(), current); !errors.Is(err, ErrNotReady) {
+				t.Fatalf("error %v, expected %v", err, ErrNotReady)
+			}
+			for i := 0; i < 2; i++ {
+				c, err := d.Check(context.Background(), current)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.Version != tc.version {
+					t.Fatalf("version %q, expected %q", c.Version, tc.version)
+				}
+			}
+			// architecture is checked once
+			if len(d.arch) != 1 {
+				t.Fatalf("architecture checked for %d binaries", len(d.arch))
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// partSuffix marks incomplete downloads in staging directory.
+const partSuffix = ".part"
+
+// revision is a record of last update fetched from a remote source.
+type revision struct {
+	Revision string `json:"revision"`
+	Checksum string `json:"checksum"`
+}
+
+// revisionPath returns sidecar file path keeping fetched revision for an executable.
+func revisionPath(staging, name string) string {
+	return filepath.Join(staging, "."+name+".revision")
+}
+
+// readRevision returns last fetched revision, empty if nothing was fetched yet.
+func readRevision(staging, name string) revision {
+	var rev revision
+	if data, err := ioutil.ReadFile(revisionPath(staging, name)); err == nil {
+		_ = json.Unmarshal(data, &rev)
+	}
+	return rev
+}
+
+// writeRevision saves fetched revision.
+func writeRevision(staging, name string, rev revision) error {
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(revisionPath(staging, name), data, 0644)
+}
+
+// fetched reports whether candidate revision is already fetched and applied to current executable.
+func fetched(staging string, current *executable.Executable, c Candidate) bool {
+	rev := readRevision(staging, c.Name)
+	return rev.Revision == c.Revision && rev.Checksum == current.Checksum()
+}
+
+// download fetches a file into dst, resuming incomplete download, and verifies it's SHA-256 checksum if it is set.
+// request must return a request for file content starting from offset, do sends it.
+func download(ctx context.Context, do func(*http.Request) (*http.Response, error), dst, checksum string,
+	request func(offset int64) (*http.Request, error)) (string, error) {
+	// staging directory is created on first download
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	part := dst + partSuffix
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if f != nil {
+			executable.CloseFile(f)
+		}
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := fi.Size()
+	req, err := request(offset)
+	if err != nil {
+		return "", err
+	}
+	resp, err := do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// server ignored range or content changed, so start over
+		if err := f.Truncate(0); err != nil {
+			return "", err
+		}
+	default:
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			_ = os.Remove(part)
+		}
+		return "", fmt.Errorf("download %s: %s", req.URL, resp.Status)
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return "", err
+	}
+	executable.CloseFile(f)
+	f = nil
+
+	sum, err := fileChecksum(part)
+	if err != nil {
+		return "", err
+	}
+	if checksum != "" && sum != checksum {
+		_ = os.Remove(part)
+		return "", fmt.Errorf("download %s: checksum mismatch: expected %s, got %s", req.URL, checksum, sum)
+	}
+	if err := os.Chmod(part, 0751); err != nil {
+		return "", err
+	}
+	if err := os.Rename(part, dst); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// fileChecksum returns hex-encoded SHA-256 checksum of a file.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer executable.CloseFile(f)
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,149 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/version"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestName is rollout manifest file name in staging directory or remote source prefix.
+const ManifestName = "manifest.json"
+
+// Artifact describes a published executable in a manifest.
+type Artifact struct {
+	Name string `json:"name"`
+	// release channel, artifact belongs to all channels if empty
+	Channel string `json:"channel,omitempty"`
+	// artifact file name in staging directory or source prefix, Name if empty
+	File string `json:"file,omitempty"`
+	// version and checksum restrict artifact to a specific build, any build matches if empty
+	Version  string `json:"version,omitempty"`
+	Checksum string `json:"sha256,omitempty"`
+	// percentage of hosts taking this artifact, configured default is used if not set
+	Rollout *int `json:"rollout,omitempty"`
+}
+
+// Matches checks whether artifact describes update candidate.
+func (a Artifact) Matches(c Candidate) bool {
+	if a.Name != c.Name {
+		return false
+	}
+	if a.Checksum != "" && c.Checksum != "" && a.Checksum != c.Checksum {
+		return false
+	}
+	return a.Version == "" || c.Version == "" || a.Version == c.Version
+}
+
+// Manifest lists published artifacts with rollout settings, it may be changed without restaging binaries.
+type Manifest struct {
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Find returns manifest artifact describing update candidate.
+func (m *Manifest) Find(c Candidate) (Artifact, bool) {
+	for _, a := range m.Artifacts {
+		if a.Matches(c) {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// Path returns artifact file name.
+func (a Artifact) Path() string {
+	if a.File != "" {
+		return a.File
+	}
+	return a.Name
+}
+
+// Has checks whether manifest lists artifacts for an executable.
+func (m *Manifest) Has(name string) bool {
+	for _, a := range m.Artifacts {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns pinned artifact for an executable or the newest one in selector channel.
+func (m *Manifest) Select(name string, sel Selector) (Artifact, bool) {
+	var selected Artifact
+	found := false
+	for _, a := range m.Artifacts {
+		if a.Name != name || (a.Channel != "" && a.Channel != sel.Channel) {
+			continue
+		}
+		if pin := sel.Pins[name]; pin != "" {
+			if version.Compare(a.Version, pin) == 0 {
+				return a, true
+			}
+			continue
+		}
+		if !found || version.Compare(a.Version, selected.Version) > 0 {
+			selected, found = a, true
+		}
+	}
+	return selected, found
+}
+
+// Selector chooses manifest artifacts by release channel and pinned versions.
+type Selector struct {
+	// release channel
+	Channel string
+	// exact versions by executable name, other versions are refused
+	Pins map[string]string
+}
+
+// Selective is implemented by update sources choosing artifacts from a manifest.
+type Selective interface {
+	SetSelector(sel Selector)
+}
+
+// ManifestSource is implemented by update sources publishing a manifest.
+type ManifestSource interface {
+	// Manifest returns current manifest, nil if it is not published.
+	Manifest(ctx context.Context) (*Manifest, error)
+}
+
+// validPath checks that artifact file path stays inside staging directory or source prefix.
+func validPath(p string) bool {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, `\`) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return false
+	}
+	for _, elem := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseManifest parses and validates manifest content.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("manifest: %s", err.Error())
+	}
+	for _, a := range m.Artifacts {
+		if a.Name == "" {
+			return nil, fmt.Errorf("manifest: artifact name is not set")
+		}
+		if !validPath(a.Path()) {
+			return nil, fmt.Errorf("manifest: %s: file must be a relative path without '..': %s", a.Name, a.Path())
+		}
+		if a.Version != "" {
+			if _, err := version.Parse(a.Version); err != nil {
+				return nil, fmt.Errorf("manifest: %s: %s", a.Name, err.Error())
+			}
+		}
+		if a.Rollout != nil && (*a.Rollout < 0 || *a.Rollout > 100) {
+			return nil, fmt.Errorf("manifest: %s rollout must be within 0..100, got %d", a.Name, *a.Rollout)
+		}
+	}
+	return &m, nil
+}
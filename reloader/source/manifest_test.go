@@ -0,0 +1,103 @@
+package source
+
+import (
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	m, err := ParseManifest([]byte(`{"artifacts": [
+		{"name": "app", "version": "1.2.0", "file": "app-1.2.0"},
+		{"name": "app", "version": "1.10.0", "file": "app-1.10.0"},
+		{"name": "app", "version": "1.3.0-rc.1", "channel": "beta", "file": "app-1.3.0-rc.1"},
+		{"name": "app", "version": "2.0.0-alpha", "channel": "alpha", "file": "app-2.0.0-alpha"},
+		{"name": "reloader", "version": "0.5.0"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		artifact string
+		sel      Selector
+		expected string
+		found    bool
+	}{
+		{"newest in default channel", "app", Selector{}, "app-1.10.0", true},
+		{"channel artifacts are excluded from default", "app", Selector{Channel: "stable"}, "app-1.10.0", true},
+		{"artifacts without channel belong to all channels", "app", Selector{Channel: "beta"}, "app-1.10.0", true},
+		{"newest in channel", "app", Selector{Channel: "alpha"}, "app-2.0.0-alpha", true},
+		{"pinned", "app", Selector{Pins: map[string]string{"app": "1.2.0"}}, "app-1.2.0", true},
+		{"pinned with prefix", "app", Selector{Pins: map[string]string{"app": "v1.2"}}, "app-1.2.0", true},
+		{"pinned in other channel", "app", Selector{Pins: map[string]string{"app": "1.3.0-rc.1"}}, "", false},
+		{"pinned in channel", "app", Selector{Channel: "beta", Pins: map[string]string{"app": "1.3.0-rc.1"}},
+			"app-1.3.0-rc.1", true},
+		{"pinned missing version", "app", Selector{Pins: map[string]string{"app": "1.4.0"}}, "", false},
+		{"pin of other artifact", "reloader", Selector{Pins: map[string]string{"app": "1.2.0"}}, "reloader", true},
+		{"missing artifact", "other", Selector{}, "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, found := m.Select(tc.artifact, tc.sel)
+			if found != tc.found {
+				t.Fatalf("found %v, expected %v", found, tc.found)
+			}
+			if found && a.Path() != tc.expected {
+				t.Fatalf("selected %s, expected %s", a.Path(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+		err  bool
+	}{
+		{"valid", `{"artifacts": [{"name": "app", "version": "1.0.0", "rollout": 50}]}`, false},
+		{"empty", `{}`, false},
+		{"not json", `artifacts`, true},
+		{"missing name", `{"artifacts": [{"version": "1.0.0"}]}`, true},
+		{"invalid version", `{"artifacts": [{"name": "app", "version": "latest"}]}`, true},
+		{"negative rollout", `{"artifacts": [{"name": "app", "rollout": -1}]}`, true},
+		{"rollout over 100", `{"artifacts": [{"name": "app", "rollout": 101}]}`, true},
+		{"file in subdirectory", `{"artifacts": [{"name": "app", "file": "builds/app-1.0.0"}]}`, false},
+		{"file with dots", `{"artifacts": [{"name": "app", "file": "app..1.0.0"}]}`, false},
+		{"absolute file", `{"artifacts": [{"name": "app", "file": "/usr/bin/app"}]}`, true},
+		{"windows absolute file", `{"artifacts": [{"name": "app", "file": "\\\\host\\app"}]}`, true},
+		{"parent file", `{"artifacts": [{"name": "app", "file": "../app"}]}`, true},
+		{"nested parent file", `{"artifacts": [{"name": "app", "file": "builds/../../app"}]}`, true},
+		{"windows parent file", `{"artifacts": [{"name": "app", "file": "builds\\..\\..\\app"}]}`, true},
+		{"parent name", `{"artifacts": [{"name": "../app"}]}`, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseManifest([]byte(tc.data))
+			if tc.err && err == nil {
+				t.Fatal("expected error")
+			}
+			if !tc.err && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestArtifactMatches(t *testing.T) {
+	a := Artifact{Name: "app", Version: "1.2.0", Checksum: "abc"}
+	testCases := []struct {
+		c        Candidate
+		expected bool
+	}{
+		{Candidate{Name: "app", Version: "1.2.0", Checksum: "abc"}, true},
+		{Candidate{Name: "app"}, true},
+		{Candidate{Name: "other", Version: "1.2.0", Checksum: "abc"}, false},
+		{Candidate{Name: "app", Checksum: "def"}, false},
+		{Candidate{Name: "app", Version: "1.3.0"}, false},
+	}
+	for _, tc := range testCases {
+		if matches := a.Matches(tc.c); matches != tc.expected {
+			t.Errorf("%+v matches %+v: %v, expected %v", a, tc.c, matches, tc.expected)
+		}
+	}
+}
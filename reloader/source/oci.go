@@ -0,0 +1,263 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// layer annotation with artifact file name
+	annotationTitle = "org.opencontainers.image.title"
+	// accepted manifest media types
+	manifestAccept = "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// manifest is a subset of OCI image manifest describing artifact layers.
+type manifest struct {
+	Layers []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Size        int64             `json:"size"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// OCI is an update source resolving a tag in OCI distribution registry. Binaries are published as
+// artifact layers with file name in org.opencontainers.image.title annotation (as oras does), layer
+// blobs are pulled by digest to staging directory.
+type OCI struct {
+	// registry base URL, i.e. https://registry.example.com
+	Registry   string
+	Repository string
+	Tag        string
+	// registry credentials for basic or token auth, anonymous tokens are requested if empty
+	Username string
+	Password string
+	// staging directory for downloaded binaries
+	Staging string
+	Client  *http.Client
+
+	mu sync.Mutex
+	// bearer token from registry token service
+	token string
+}
+
+// Check resolves tag to manifest and looks for a layer named as current executable.
+// Layer is not an update if manifest digest is already fetched and applied or layer digest matches
+// current binary checksum.
+func (o *OCI) Check(ctx context.Context, current *executable.Executable) (Candidate, error) {
+	req, err := http.NewRequest(http.MethodGet, o.url("manifests", o.Tag), nil)
+	if err != nil {
+		return Candidate{}, err
+	}
+	req.Header.Set("Accept", manifestAccept)
+	resp, err := o.do(req.WithContext(ctx))
+	if err != nil {
+		return Candidate{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return Candidate{}, ErrNoUpdate
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Candidate{}, fmt.Errorf("manifest %s:%s: %s", o.Repository, o.Tag, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Candidate{}, err
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = "sha256:" + hexSHA256(body)
+	}
+	var m manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return Candidate{}, fmt.Errorf("manifest %s:%s: %s", o.Repository, o.Tag, err.Error())
+	}
+	for _, layer := range m.Layers {
+		if layer.Annotations[annotationTitle] != current.String() {
+			continue
+		}
+		if !strings.HasPrefix(layer.Digest, "sha256:") {
+			return Candidate{}, fmt.Errorf("unsupported layer digest %s", layer.Digest)
+		}
+		c := Candidate{
+			Name:     current.String(),
+			Location: layer.Digest,
+			Checksum: strings.TrimPrefix(layer.Digest, "sha256:"),
+			Version:  m.Annotations["org.opencontainers.image.version"],
+			Revision: digest,
+		}
+		if c.Checksum == current.Checksum() || fetched(o.Staging, current, c) {
+			return Candidate{}, ErrNoUpdate
+		}
+		return c, nil
+	}
+	// artifact doesn't contain this executable
+	return Candidate{}, ErrNoUpdate
+}
+
+// Fetch pulls layer blob by digest to staging directory and verifies it's digest.
+func (o *OCI) Fetch(ctx context.Context, c Candidate) (string, error) {
+	dst := filepath.Join(o.Staging, c.Name)
+	if rev := readRevision(o.Staging, c.Name); rev.Revision == c.Revision {
+		if sum, err := fileChecksum(dst); err == nil && sum == rev.Checksum {
+			// already downloaded but not applied yet
+			return dst, nil
+		}
+	}
+	sum, err := download(ctx, o.do, dst, c.Checksum, func(offset int64) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, o.url("blobs", c.Location), nil)
+		if err != nil {
+			return nil, err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := writeRevision(o.Staging, c.Name, revision{Revision: c.Revision, Checksum: sum}); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// url returns registry API URL for manifests or blobs.
+func (o *OCI) url(kind, reference string) string {
+	return strings.TrimRight(o.Registry, "/") + "/v2/" + o.Repository + "/" + kind + "/" + reference
+}
+
+// do sends a request with registry authorization, authenticating and retrying once on 401 response.
+func (o *OCI) do(req *http.Request) (*http.Response, error) {
+	o.authorize(req)
+	resp, err := o.Client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	_ = resp.Body.Close()
+	if err := o.authenticate(req, resp.Header.Get("WWW-Authenticate")); err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	o.authorize(retry)
+	return o.Client.Do(retry)
+}
+
+// authorize adds bearer token or basic credentials to a request.
+func (o *OCI) authorize(req *http.Request) {
+	o.mu.Lock()
+	token := o.token
+	o.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if o.Username != "" {
+		req.SetBasicAuth(o.Username, o.Password)
+	}
+}
+
+// authenticate requests a bearer token from token service described by WWW-Authenticate challenge.
+func (o *OCI) authenticate(req *http.Request, challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return errors.New("registry authentication failed")
+	}
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid registry auth challenge: %s", challenge)
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		query.Set("scope", params["scope"])
+	} else {
+		query.Set("scope", "repository:"+o.Repository+":pull")
+	}
+	realm.RawQuery = query.Encode()
+	tokenReq, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if o.Username != "" {
+		tokenReq.SetBasicAuth(o.Username, o.Password)
+	}
+	resp, err := o.Client.Do(tokenReq.WithContext(req.Context()))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token = token.Token; o.token == "" {
+		o.token = token.AccessToken
+	}
+	if o.token == "" {
+		return errors.New("registry token: empty token")
+	}
+	return nil
+}
+
+// parseChallenge parses comma-separated key="value" pairs of WWW-Authenticate header.
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				break
+			}
+			value = s[1 : end+1]
+			s = s[end+2:]
+		} else if comma := strings.IndexByte(s, ','); comma >= 0 {
+			value = s[:comma]
+			s = s[comma:]
+		} else {
+			value, s = s, ""
+		}
+		params[key] = value
+		s = strings.TrimLeft(s, ", ")
+	}
+	return params
+}
+
+// NewOCI returns an update source for registry repository tag.
+func NewOCI(registry, repository, tag, staging string) *OCI {
+	return &OCI{
+		Registry:   registry,
+		Repository: repository,
+		Tag:        tag,
+		Staging:    staging,
+		Client:     http.DefaultClient,
+	}
+}
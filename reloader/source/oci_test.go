@@ -0,0 +1,254 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRegistry serves manifests and blobs of a single repository with token authentication.
+type fakeRegistry struct {
+	t        *testing.T
+	url      string
+	username string
+	password string
+	token    string
+	// manifests by tag and blobs by digest
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	// number of issued tokens
+	tokens int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		f.issueToken(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+			`Bearer realm="%s/token",service="registry.test",scope="repository:myorg/app:pull"`, f.url))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v2/myorg/app/manifests/"):
+		body, ok := f.manifests[strings.TrimPrefix(r.URL.Path, "/v2/myorg/app/manifests/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.manifest.v1+json") {
+			f.t.Errorf("manifest requested with Accept %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:"+hexSHA256(body))
+		_, _ = w.Write(body)
+	case strings.HasPrefix(r.URL.Path, "/v2/myorg/app/blobs/"):
+		body, ok := f.blobs[strings.TrimPrefix(r.URL.Path, "/v2/myorg/app/blobs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(body)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// issueToken returns bearer token for valid basic credentials and requested scope.
+func (f *fakeRegistry) issueToken(w http.ResponseWriter, r *http.Request) {
+	if user, pass, _ := r.BasicAuth(); user != f.username || pass != f.password {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if q := r.URL.Query(); q.Get("service") != "registry.test" || q.Get("scope") != "repository:myorg/app:pull" {
+		f.t.Errorf("unexpected token request %s", r.URL.RawQuery)
+	}
+	f.tokens++
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": f.token})
+}
+
+// publish stores artifact manifest with tag and layers named as files, version is set as manifest annotation.
+func (f *fakeRegistry) publish(tag, version string, files map[string]string) {
+	type layer struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Size        int               `json:"size"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	var m struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		Layers        []layer           `json:"layers"`
+		Annotations   map[string]string `json:"annotations,omitempty"`
+	}
+	m.SchemaVersion = 2
+	if version != "" {
+		m.Annotations = map[string]string{"org.opencontainers.image.version": version}
+	}
+	for name, content := range files {
+		digest := "sha256:" + sha256hex(content)
+		f.blobs[digest] = []byte(content)
+		m.Layers = append(m.Layers, layer{
+			MediaType:   "application/octet-stream",
+			Digest:      digest,
+			Size:        len(content),
+			Annotations: map[string]string{annotationTitle: name},
+		})
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.manifests[tag] = data
+}
+
+// newTestOCI starts fake registry and returns update source for myorg/app:stable.
+func newTestOCI(t *testing.T) (*OCI, *fakeRegistry, func()) {
+	fake := &fakeRegistry{
+		t:         t,
+		username:  "user",
+		password:  "secret",
+		token:     "token-1",
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+	server := httptest.NewServer(fake)
+	fake.url = server.URL
+	staging, err := ioutil.TempDir("", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := NewOCI(server.URL, "myorg/app", "stable", staging)
+	o.Username, o.Password = "user", "secret"
+	o.Client = server.Client()
+	return o, fake, func() {
+		server.Close()
+		_ = os.RemoveAll(staging)
+	}
+}
+
+func TestOCICheckFetch(t *testing.T) {
+	current, cleanup := newTestExecutable(t, "old binary")
+	defer cleanup()
+	o, fake, stop := newTestOCI(t)
+	defer stop()
+	fake.publish("stable", "1.2.0", map[string]string{"app": "new binary", "reloader": "new reloader"})
+
+	c, err := o.Check(context.Background(), current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Candidate{
+		Name:     "app",
+		Location: "sha256:" + sha256hex("new binary"),
+		Checksum: sha256hex("new binary"),
+		Version:  "1.2.0",
+		Revision: "sha256:" + hexSHA256(fake.manifests["stable"]),
+	}
+	if c != expected {
+		t.Fatalf("unexpected candidate %+v", c)
+	}
+	path, err := o.Fetch(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "new binary" {
+		t.Fatalf("fetched %q, %v", data, err)
+	}
+	if fake.tokens != 1 {
+		t.Fatalf("expected token to be reused, %d tokens issued", fake.tokens)
+	}
+}
+
+func TestOCINoUpdate(t *testing.T) {
+	current, cleanup := newTestExecutable(t, "old binary")
+	defer cleanup()
+	testCases := []struct {
+		name  string
+		tag   string
+		files map[string]string
+	}{
+		{"missing tag", "latest", map[string]string{"app": "new binary"}},
+		{"no layer", "stable", map[string]string{"reloader": "new reloader"}},
+		{"current binary", "stable", map[string]string{"app": "old binary"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, fake, stop := newTestOCI(t)
+			defer stop()
+			fake.publish(tc.tag, "", tc.files)
+			if c, err := o.Check(context.Background(), current); err != ErrNoUpdate {
+				t.Fatalf("expected no update, got %+v, %v", c, err)
+			}
+		})
+	}
+}
+
+func TestOCIDigestMismatch(t *testing.T) {
+	current, cleanup := newTestExecutable(t, "old binary")
+	defer cleanup()
+	o, fake, stop := newTestOCI(t)
+	defer stop()
+	fake.publish("stable", "", map[string]string{"app": "new binary"})
+	fake.blobs["sha256:"+sha256hex("new binary")] = []byte("tampered binary")
+
+	c, err := o.Check(context.Background(), current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Fetch(context.Background(), c); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(o.Staging, "app")); !os.IsNotExist(err) {
+		t.Fatalf("tampered blob is kept in staging: %v", err)
+	}
+}
+
+func TestOCIBadCredentials(t *testing.T) {
+	current, cleanup := newTestExecutable(t, "old binary")
+	defer cleanup()
+	o, fake, stop := newTestOCI(t)
+	defer stop()
+	fake.publish("stable", "", map[string]string{"app": "new binary"})
+	o.Password = "wrong"
+	if _, err := o.Check(context.Background(), current); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected token error, got %v", err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	testCases := []struct {
+		challenge string
+		expected  map[string]string
+	}{
+		{
+			`realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull"`,
+			map[string]string{
+				"realm":   "https://auth.example.com/token",
+				"service": "registry.example.com",
+				"scope":   "repository:a/b:pull",
+			},
+		},
+		{
+			`realm="https://auth.example.com/token", scope="repository:a/b:pull,push"`,
+			map[string]string{"realm": "https://auth.example.com/token", "scope": "repository:a/b:pull,push"},
+		},
+		{`realm=https://auth.example.com/token,service=registry`,
+			map[string]string{"realm": "https://auth.example.com/token", "service": "registry"}},
+		{``, map[string]string{}},
+	}
+	for _, tc := range testCases {
+		if params := parseChallenge(tc.challenge); !reflect.DeepEqual(params, tc.expected) {
+			t.Errorf("parseChallenge(%q) = %v, expected %v", tc.challenge, params, tc.expected)
+		}
+	}
+}
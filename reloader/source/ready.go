@@ -0,0 +1,94 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotReady is returned by Check when staged update is still being written.
+var ErrNotReady = errors.New("staged update is not ready")
+
+// ReadySuffix marks staged files completely written when ready markers are required.
+const ReadySuffix = ".ready"
+
+// tempSuffixes mark incomplete files written by download and copy tools.
+var tempSuffixes = []string{".part", ".partial", ".tmp", ".temp", ".download", ".crdownload", ".filepart"}
+
+// observation is staged file state seen on previous check.
+type observation struct {
+	size     int64
+	modified time.Time
+	checksum string
+}
+
+// inProgress checks whether a temporary file for path exists, i.e. app.part or rsync's .app.Xy12Zw.
+func inProgress(path string) (string, bool) {
+	for _, suffix := range tempSuffixes {
+		if _, err := os.Stat(path + suffix); err == nil {
+			return path + suffix, true
+		}
+	}
+	dir, name := filepath.Split(path)
+	if matches, err := filepath.Glob(filepath.Join(dir, ".*")); err == nil {
+		for _, m := range matches {
+			if rsyncTemp(filepath.Base(m), name) {
+				return m, true
+			}
+		}
+	}
+	return "", false
+}
+
+// rsyncTemp checks whether base is rsync's temporary file name for name, i.e. .app.Xy12Zw.
+func rsyncTemp(base, name string) bool {
+	prefix := "." + name + "."
+	if len(base) != len(prefix)+6 || !strings.HasPrefix(base, prefix) {
+		return false
+	}
+	for _, c := range base[len(prefix):] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// ready checks that staged file at path with given checksum is completely written.
+// Files having temporary companions are never ready. If trusted is set (i.e. checksum is verified by manifest)
+// or ready marker not older than file exists, file is ready. Otherwise it's size, modification time and
+// checksum must be the same as on previous check.
+func (d *Dir) ready(path, checksum string, trusted bool) error {
+	if tmp, ok := inProgress(path); ok {
+		return fmt.Errorf("%w: %s is being written", ErrNotReady, tmp)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if d.readyMarker {
+		marker, err := os.Stat(path + ReadySuffix)
+		if err != nil || marker.ModTime().Before(fi.ModTime()) {
+			return fmt.Errorf("%w: %s is not marked ready", ErrNotReady, path)
+		}
+		return nil
+	}
+	if trusted {
+		return nil
+	}
+	current := observation{size: fi.Size(), modified: fi.ModTime(), checksum: checksum}
+	prev, seen := d.seen[path]
+	d.seen[path] = current
+	if !seen || prev != current {
+		return fmt.Errorf("%w: %s is not stable yet", ErrNotReady, path)
+	}
+	return nil
+}
+
+// SetReadyMarker requires <file>.ready marker for staged files, so they are not checked for stability.
+func (d *Dir) SetReadyMarker(required bool) {
+	d.readyMarker = required
+}
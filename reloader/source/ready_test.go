@@ -0,0 +1,28 @@
+package source
+
+import (
+	"testing"
+)
+
+func TestRsyncTemp(t *testing.T) {
+	testCases := []struct {
+		base     string
+		name     string
+		expected bool
+	}{
+		{".app.Xy12Zw", "app", true},
+		{".app.tar.gz.a1B2c3", "app.tar.gz", true},
+		{".app.Xy12Z", "app", false},
+		{".app.Xy12Zw1", "app", false},
+		{".app.Xy-2Zw", "app", false},
+		{".apq.Xy12Zw", "app", false},
+		{"app.Xy12Zw", "app", false},
+		{".app", "app", false},
+		{".reloader.pid", "reloader", false},
+	}
+	for _, tc := range testCases {
+		if temp := rsyncTemp(tc.base, tc.name); temp != tc.expected {
+			t.Errorf("rsyncTemp(%q, %q) = %v, expected %v", tc.base, tc.name, temp, tc.expected)
+		}
+	}
+}
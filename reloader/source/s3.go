@@ -0,0 +1,288 @@
+package source
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// SHA-256 of empty request payload
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// object metadata keys with new binary checksum and version
+	metaChecksum = "X-Amz-Meta-Sha256"
+	metaVersion  = "X-Amz-Meta-Version"
+)
+
+// S3 is an update source polling objects with executable names under a prefix in S3-compatible bucket.
+// Objects are downloaded to staging directory.
+type S3 struct {
+	// service endpoint, i.e. https://s3.amazonaws.com or http://localhost:9000
+	Endpoint string
+	Bucket   string
+	Prefix   string
+	Region   string
+	// credentials, anonymous requests are sent if AccessKey is empty
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// staging directory for downloaded binaries
+	Staging string
+	Client  *http.Client
+	// chooses artifacts when prefix contains a manifest
+	Selector Selector
+}
+
+// Check compares object metadata with current executable.
+// Object is not an update if it's sha256 metadata matches current checksum, it's ETag matches current
+// binary MD5 or if it's ETag is already fetched and applied.
+func (s *S3) Check(ctx context.Context, current *executable.Executable) (Candidate, error) {
+	key := s.Prefix + current.String()
+	m, err := s.Manifest(ctx)
+	if err != nil {
+		return Candidate{}, err
+	}
+	var selected *Artifact
+	if m != nil && m.Has(current.String()) {
+		a, ok := m.Select(current.String(), s.Selector)
+		if !ok {
+			return Candidate{}, ErrNoUpdate
+		}
+		selected = &a
+		key = s.Prefix + a.Path()
+	}
+	req, err := s.request(http.MethodHead, key, nil)
+	if err != nil {
+		return Candidate{}, err
+	}
+	resp, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Candidate{}, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return Candidate{}, ErrNoUpdate
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Candidate{}, fmt.Errorf("head %s: %s", key, resp.Status)
+	}
+	c := Candidate{
+		Name:     current.String(),
+		Location: key,
+		Checksum: strings.ToLower(resp.Header.Get(metaChecksum)),
+		Version:  resp.Header.Get(metaVersion),
+		Revision: resp.Header.Get("ETag"),
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		c.Modified = modified
+	}
+	if selected != nil {
+		c.Selected = true
+		if selected.Version != "" {
+			c.Version = selected.Version
+		}
+		if selected.Checksum != "" {
+			c.Checksum = selected.Checksum
+		}
+	}
+	if c.Checksum != "" {
+		if c.Checksum == current.Checksum() {
+			return Candidate{}, ErrNoUpdate
+		}
+		return c, nil
+	}
+	if etag := strings.Trim(c.Revision, `"`); !strings.Contains(etag, "-") {
+		// single part upload ETag is content MD5
+		if sum, err := md5sum(current.Path()); err == nil && sum == etag {
+			return Candidate{}, ErrNoUpdate
+		}
+	}
+	if fetched(s.Staging, current, c) {
+		return Candidate{}, ErrNoUpdate
+	}
+	return c, nil
+}
+
+// Fetch downloads object to staging directory, resuming previous incomplete download.
+func (s *S3) Fetch(ctx context.Context, c Candidate) (string, error) {
+	dst := filepath.Join(s.Staging, c.Name)
+	if rev := readRevision(s.Staging, c.Name); rev.Revision == c.Revision {
+		if sum, err := fileChecksum(dst); err == nil && sum == rev.Checksum {
+			// already downloaded but not applied yet
+			return dst, nil
+		}
+	}
+	sum, err := download(ctx, s.Client.Do, dst, c.Checksum, func(offset int64) (*http.Request, error) {
+		header := make(http.Header)
+		if offset > 0 {
+			header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			header.Set("If-Range", c.Revision)
+		}
+		return s.request(http.MethodGet, c.Location, header)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := writeRevision(s.Staging, c.Name, revision{Revision: c.Revision, Checksum: sum}); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// Manifest downloads manifest object from bucket prefix.
+func (s *S3) Manifest(ctx context.Context) (*Manifest, error) {
+	key := s.Prefix + ManifestName
+	req, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: %s", key, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// SetSelector configures manifest artifacts selection.
+func (s *S3) SetSelector(sel Selector) {
+	s.Selector = sel
+}
+
+// request returns a signed path-style request for an object.
+func (s *S3) request(method, key string, header http.Header) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimRight(s.Endpoint, "/") + "/" + s.Bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.AccessKey != "" {
+		s.sign(req, time.Now().UTC())
+	}
+	return req, nil
+}
+
+// sign adds AWS Signature Version 4 authorization headers to a request without payload, signing all request headers.
+func (s *S3) sign(req *http.Request, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// escapePath URI-encodes every path segment as required by SigV4.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(url.QueryEscape(segment), "+", "%20", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// md5sum returns hex-encoded MD5 checksum of a file.
+func md5sum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer executable.CloseFile(f)
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewS3 returns an update source for bucket prefix with credentials from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func NewS3(endpoint, bucket, prefix, region, staging string) *S3 {
+	return &S3{
+		Endpoint:     endpoint,
+		Bucket:       bucket,
+		Prefix:       prefix,
+		Region:       region,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Staging:      staging,
+		Client:       http.DefaultClient,
+	}
+}
@@ -0,0 +1,41 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"time"
+)
+
+// ErrNoUpdate is returned by UpdateSource.Check when current executable is up to date.
+var ErrNoUpdate = errors.New("no update available")
+
+// Candidate describes an update found by an update source.
+type Candidate struct {
+	// executable name
+	Name string
+	// update location in source: file path, URL or object key
+	Location string
+	// path to binary a delta patch at Location is applied to, empty for full binaries
+	Base string
+	// hex-encoded SHA-256 checksum of new binary, empty if unknown before fetch
+	Checksum string
+	// new binary version, empty if unknown
+	Version string
+	// source-specific revision, i.e. object ETag or manifest digest
+	Revision string
+	// new binary modification time
+	Modified time.Time
+	// new binary Go build metadata, nil if unknown before fetch
+	Build *executable.BuildInfo
+	// candidate is selected by manifest channel or pinned version, so it may be older than current binary
+	Selected bool
+}
+
+// UpdateSource discovers and fetches executable updates.
+type UpdateSource interface {
+	// Check returns an update candidate for current executable or ErrNoUpdate.
+	Check(ctx context.Context, current *executable.Executable) (Candidate, error)
+	// Fetch makes candidate available on local file system and returns path to new binary.
+	Fetch(ctx context.Context, c Candidate) (string, error)
+}
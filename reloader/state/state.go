@@ -0,0 +1,151 @@
+// Package state implements reloader state kept on disk across restarts.
+package state
+
+import (
+	"encoding/json"
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// FileName is a name of state file in state directory.
+	FileName = "state.json"
+	// MaxHistory is a number of update history entries kept in state.
+	MaxHistory = 100
+)
+
+// Entry is an update history record.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// executable name
+	Name string `json:"name"`
+	// switch, activate or self-update
+	Action string `json:"action"`
+	// previous and new binary checksums
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+	Version string `json:"version,omitempty"`
+	Release string `json:"release,omitempty"`
+}
+
+// Failure is a build that failed validation or self update and is not applied again.
+type Failure struct {
+	Time     time.Time `json:"time"`
+	Name     string    `json:"name"`
+	Checksum string    `json:"checksum,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	Reason   string    `json:"reason"`
+}
+
+// State is reloader state kept across restarts.
+type State struct {
+	// last update check time
+	LastCheck time.Time `json:"last_check,omitempty"`
+	// number of child process restarts after exit
+	Restarts int `json:"restarts"`
+	// number of child process exits with non-zero code or by signal not caused by reloader
+	Crashes int `json:"crashes"`
+	// last child process exit status
+	LastExit *executable.ExitStatus `json:"last_exit,omitempty"`
+	// last applied update by executable name
+	Applied map[string]Entry `json:"applied,omitempty"`
+	// update history, oldest first
+	History []Entry `json:"history,omitempty"`
+	// bad builds by key
+	Failures map[string]Failure `json:"failures,omitempty"`
+}
+
+// Record adds update history entry and remembers it as last applied one.
+func (s *State) Record(e Entry) {
+	if s.Applied == nil {
+		s.Applied = make(map[string]Entry)
+	}
+	s.Applied[e.Name] = e
+	s.History = append(s.History, e)
+	if len(s.History) > MaxHistory {
+		s.History = append([]Entry{}, s.History[len(s.History)-MaxHistory:]...)
+	}
+}
+
+// Fail adds a bad build with key.
+func (s *State) Fail(key string, f Failure) {
+	if s.Failures == nil {
+		s.Failures = make(map[string]Failure)
+	}
+	s.Failures[key] = f
+}
+
+// Store keeps State in a JSON file.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	state State
+}
+
+// Path returns state file path.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// State returns a copy of current state.
+func (s *Store) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.state
+	st.Applied = make(map[string]Entry, len(s.state.Applied))
+	for k, v := range s.state.Applied {
+		st.Applied[k] = v
+	}
+	st.History = append([]Entry{}, s.state.History...)
+	st.Failures = make(map[string]Failure, len(s.state.Failures))
+	for k, v := range s.state.Failures {
+		st.Failures[k] = v
+	}
+	return st
+}
+
+// Update modifies state with f and saves it to disk. State file is replaced atomically.
+func (s *Store) Update(f func(st *State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.state)
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Read reads state from state directory, empty state is returned if it doesn't exist.
+func Read(dir string) (State, error) {
+	var st State
+	data, err := ioutil.ReadFile(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(data, &st)
+	return st, err
+}
+
+// Open reads state from state directory, creating directory if it doesn't exist.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	st, err := Read(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: filepath.Join(dir, FileName), state: st}, nil
+}
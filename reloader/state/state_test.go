@@ -0,0 +1,120 @@
+package state
+
+import (
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// tempDir returns temporary state directory removed after test.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(tempDir(t), "state")
+	// missing state directory is created
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Path() != filepath.Join(dir, FileName) {
+		t.Fatalf("state file %s", s.Path())
+	}
+	at := time.Unix(1579539821, 0).UTC()
+	if err := s.Update(func(st *State) {
+		st.LastCheck = at
+		st.Restarts++
+		st.Crashes++
+		st.LastExit = &executable.ExitStatus{Code: -1, Signal: "killed", SignalNumber: 9}
+		st.Record(Entry{Time: at, Name: "app", Action: "switch", From: "a", To: "b", Version: "1.2.0"})
+		st.Fail("c /staging/app", Failure{Time: at, Name: "app", Checksum: "c", Reason: "smoke test"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// state file is replaced, temporary file is not left behind
+	if _, err := os.Stat(s.Path() + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file: %v", err)
+	}
+	st, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.LastCheck.Equal(at) || st.Restarts != 1 || st.Crashes != 1 || st.LastExit == nil ||
+		st.LastExit.Signal != "killed" || st.Applied["app"].To != "b" || len(st.History) != 1 ||
+		st.Failures["c /staging/app"].Reason != "smoke test" {
+		t.Fatalf("unexpected state %+v", st)
+	}
+	// reopened store keeps state
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := s.State(); st.Restarts != 1 || len(st.History) != 1 {
+		t.Fatalf("unexpected state %+v", st)
+	}
+}
+
+func TestStoreState(t *testing.T) {
+	s, err := Open(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(func(st *State) {
+		st.Record(Entry{Name: "app", To: "a"})
+		st.Fail("a", Failure{Name: "app"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// returned copy doesn't share maps and history with store
+	st := s.State()
+	st.Record(Entry{Name: "app", To: "b"})
+	st.Fail("b", Failure{Name: "app"})
+	st.History[0].To = "c"
+	if st := s.State(); st.Applied["app"].To != "a" || len(st.History) != 1 || st.History[0].To != "a" ||
+		len(st.Failures) != 1 {
+		t.Fatalf("store state is modified: %+v", st)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	var st State
+	for i := 0; i < MaxHistory+10; i++ {
+		st.Record(Entry{Name: "app", To: strconv.Itoa(i)})
+	}
+	st.Record(Entry{Name: "reloader", To: "self"})
+	// history is truncated to last entries, last applied update is kept per executable
+	if len(st.History) != MaxHistory || st.History[0].To != "11" || st.History[MaxHistory-1].To != "self" {
+		t.Fatalf("history from %s to %s, %d entries", st.History[0].To, st.History[len(st.History)-1].To,
+			len(st.History))
+	}
+	if st.Applied["app"].To != strconv.Itoa(MaxHistory+9) || st.Applied["reloader"].To != "self" {
+		t.Fatalf("applied %+v", st.Applied)
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir := tempDir(t)
+	// missing state file is an empty state
+	if st, err := Read(dir); err != nil || st.Restarts != 0 || st.History != nil {
+		t.Fatalf("state %+v, %v", st, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, FileName), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(dir); err == nil {
+		t.Fatal("malformed state is read")
+	}
+	if _, err := Open(dir); err == nil {
+		t.Fatal("malformed state is opened")
+	}
+}
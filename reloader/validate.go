@@ -0,0 +1,43 @@
+package reloader
+
+import (
+	"github.com/tumb1er/go-reloader/reloader/executable"
+	"github.com/tumb1er/go-reloader/reloader/release"
+	"github.com/tumb1er/go-reloader/reloader/source"
+)
+
+// validate checks that fetched update for cmd may be switched in. Bundles are validated after unpacking by
+// installRelease, failed bundles are rejected by switchChild the same way.
+func (r *Reloader) validate(cmd *executable.Executable, path string) error {
+	if release.IsBundle(path) {
+		return nil
+	}
+	return r.validateBinary(cmd, path)
+}
+
+// validateBinary checks that binary is built for host OS and architecture and passes smoke test
+// if it is configured for child executable.
+func (r *Reloader) validateBinary(cmd *executable.Executable, path string) error {
+	if err := executable.CheckArch(path); err != nil {
+		return err
+	}
+	if cmd == r.cmd && len(r.smoke) > 0 {
+		return executable.Smoke(path, r.smoke, r.smokeTimeout)
+	}
+	return nil
+}
+
+// invalidKey identifies an update candidate that failed validation.
+func invalidKey(c source.Candidate) string {
+	return c.Checksum + " " + c.Location
+}
+
+// reject remembers an update that failed validation, so it is not fetched and validated again, even after restart.
+func (r *Reloader) reject(cmd *executable.Executable, c source.Candidate, err error) {
+	if r.invalid == nil {
+		r.invalid = make(map[string]string)
+	}
+	r.invalid[invalidKey(c)] = err.Error()
+	r.recordFailure(cmd, invalidKey(c), c, err.Error())
+	r.refuse(cmd, c, err.Error())
+}
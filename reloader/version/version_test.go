@@ -0,0 +1,88 @@
+package version
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected Version
+		err      bool
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, false},
+		{"v1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, false},
+		{" v2 ", Version{Major: 2}, false},
+		{"1.2", Version{Major: 1, Minor: 2}, false},
+		{"1.2.3-rc.1", Version{Major: 1, Minor: 2, Patch: 3, Pre: []string{"rc", "1"}}, false},
+		{"1.2.3+build.5", Version{Major: 1, Minor: 2, Patch: 3, Build: "build.5"}, false},
+		{"1.2.3-beta+exp-sha.5114f85", Version{Major: 1, Minor: 2, Patch: 3, Pre: []string{"beta"},
+			Build: "exp-sha.5114f85"}, false},
+		{"", Version{}, true},
+		{"v", Version{}, true},
+		{"1.2.3.4", Version{}, true},
+		{"1.x.3", Version{}, true},
+		{"1.-2.3", Version{}, true},
+		{"1.2.3-", Version{}, true},
+		{"devel", Version{}, true},
+	}
+	for _, tc := range testCases {
+		v, err := Parse(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, expected error", tc.s, v)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("Parse(%q) = %#v, %v, expected %#v", tc.s, v, err, tc.expected)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.2.3+a", "1.2.3+b", 0},
+		{"1.2.4", "1.2.3", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0-rc.1", "0.9.0", 1},
+		{"1.0.0", "devel", 1},
+		{"devel", "1.0.0", -1},
+		{"abc", "abd", -1},
+		{"", "", 0},
+	}
+	for _, tc := range testCases {
+		if c := Compare(tc.a, tc.b); c != tc.expected {
+			t.Errorf("Compare(%q, %q) = %d, expected %d", tc.a, tc.b, c, tc.expected)
+		}
+		if c := Compare(tc.b, tc.a); c != -tc.expected {
+			t.Errorf("Compare(%q, %q) = %d, expected %d", tc.b, tc.a, c, -tc.expected)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, s := range []string{"1.2.3", "0.0.1-rc.1", "1.0.0-beta+build.1"} {
+		v, err := Parse("v" + s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.String() != s {
+			t.Errorf("Parse(%q).String() = %q", "v"+s, v.String())
+		}
+	}
+}
@@ -31,7 +31,7 @@ func (s service) Start() error {
 		if ret == 0 {
 			panic(err)
 		}
-		if err := s.r.Run(); err != nil {
+		if err := s.r.Run(); err != nil && !errors.Is(err, ErrUpdated) {
 			panic(err)
 		}
 	}()
@@ -40,7 +40,7 @@ func (s service) Start() error {
 
 // Stops marks reloader as not running and terminates reloader child process.
 func (s service) Stop() error {
-	s.r.stopReloader()
+	s.r.Stop()
 	return nil
 }
 
@@ -54,17 +54,21 @@ func (s service) Init(env svc.Environment) error {
 
 // Daemonize makes a Windows service from current process.
 func (r *Reloader) Daemonize() error {
+	if r.handover {
+		return errors.New("child handover is not supported in daemon mode")
+	}
+	r.daemon = true
 	s := service{r: r}
 	return svc.Run(s, syscall.SIGTERM, syscall.SIGINT)
 }
 
-func (r Reloader) RestartDaemon(name string) error {
+func (r *Reloader) RestartDaemon(name string) error {
 	r.logger.Printf("Stopping daemon %s", name)
 	cmd := exec.Command("sc", "stop", name)
 	cmd.Stdout = r.stdout
 	cmd.Stderr = r.stderr
 	if err := cmd.Start(); err != nil {
-		r.logger.Fatalf("service stop error: %s", err.Error())
+		r.logger.Printf("service stop error: %s", err.Error())
 		return err
 	}
 	if err := cmd.Wait(); err != nil {
@@ -74,20 +78,20 @@ func (r Reloader) RestartDaemon(name string) error {
 				return err
 			}
 		} else {
-			r.logger.Fatalf("service stop failed: %s", err.Error())
+			r.logger.Printf("service stop failed: %s", err.Error())
 			return err
 		}
 	}
 
-	cmd = exec.Command("sc", "start", "icm_client")
+	cmd = exec.Command("sc", "start", name)
 	cmd.Stdout = r.stdout
 	cmd.Stderr = r.stderr
 	if err := cmd.Start(); err != nil {
-		r.logger.Fatalf("service start error: %s", err.Error())
+		r.logger.Printf("service start error: %s", err.Error())
 		return err
 	}
 	if err := cmd.Wait(); err != nil {
-		r.logger.Fatalf("service start failed: %s", err.Error())
+		r.logger.Printf("service start failed: %s", err.Error())
 		return err
 	}
 	return nil